@@ -0,0 +1,178 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	kindUnknown uint8 = iota
+	kindRows
+	kindExec
+)
+const (
+	// DialectDefault is the default Dialect, which does not modify placeholders.
+	// This is used by drivers that support '?' placeholders, such as MySQL and
+	// SQLite.
+	DialectDefault Dialect = iota
+	// DialectPostgres is a Dialect that rewrites '?' placeholders into numbered
+	// '$1', '$2', ... placeholders.
+	DialectPostgres
+)
+
+// Dialect is a type that represents the placeholder style used by a database
+// driver. When set on a Map, any '?' placeholders in queries will be rewritten
+// to the Dialect's style before they are prepared.
+type Dialect uint8
+
+func (d Dialect) rewrite(q string) string {
+	if d == DialectDefault {
+		return q
+	}
+	var (
+		b = make([]byte, 0, len(q)+8)
+		n int
+		l int
+	)
+	placeholders(q, func(i int) {
+		if q[i] != '?' {
+			return
+		}
+		n++
+		b = append(append(b, q[l:i]...), '$')
+		b = strconv.AppendInt(b, int64(n), 10)
+		l = i + 1
+	})
+	return string(append(b, q[l:]...))
+}
+func count(q string) int {
+	var n, v int
+	placeholders(q, func(i int) {
+		switch q[i] {
+		case '?':
+			n++
+			return
+		case ':':
+			return
+		}
+		j := i + 1
+		for j < len(q) && q[j] >= '0' && q[j] <= '9' {
+			j++
+		}
+		if x, err := strconv.Atoi(q[i+1 : j]); err == nil && x > v {
+			v = x
+		}
+	})
+	if n > 0 {
+		return n
+	}
+	return v
+}
+func classify(q string) uint8 {
+	// Skip any leading whitespace and comments before the first keyword.
+	for q = strings.TrimSpace(q); ; q = strings.TrimSpace(q) {
+		if strings.HasPrefix(q, "--") {
+			if i := strings.IndexByte(q, '\n'); i > 0 {
+				q = q[i:]
+				continue
+			}
+			return kindUnknown
+		}
+		if strings.HasPrefix(q, "/*") {
+			if i := strings.Index(q, "*/"); i > 0 {
+				q = q[i+2:]
+				continue
+			}
+			return kindUnknown
+		}
+		break
+	}
+	var (
+		w []string
+		l = -1
+	)
+	for i := 0; i <= len(q); i++ {
+		if i < len(q) && (q[i] >= 'a' && q[i] <= 'z' || q[i] >= 'A' && q[i] <= 'Z' || q[i] == '_') {
+			if l < 0 {
+				l = i
+			}
+			continue
+		}
+		if l >= 0 {
+			w, l = append(w, strings.ToUpper(q[l:i])), -1
+		}
+	}
+	if len(w) == 0 {
+		return kindUnknown
+	}
+	switch w[0] {
+	case "SELECT", "WITH":
+		for _, v := range w[1:] {
+			if v == "INSERT" || v == "UPDATE" || v == "DELETE" {
+				return kindUnknown
+			}
+		}
+		return kindRows
+	case "INSERT", "UPDATE", "DELETE":
+		for _, v := range w[1:] {
+			if v == "RETURNING" {
+				return kindUnknown
+			}
+		}
+		return kindExec
+	}
+	return kindUnknown
+}
+func placeholders(q string, f func(int)) {
+	var t byte
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		switch {
+		case t == '\n' || t == '*':
+			// Inside a comment, '\n' marks a line comment and '*' marks a block
+			// comment.
+			if t == '\n' && c == '\n' {
+				t = 0
+			} else if t == '*' && c == '*' && i+1 < len(q) && q[i+1] == '/' {
+				t = 0
+				i++
+			}
+		case t != 0:
+			if c == t {
+				t = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			t = c
+		case c == '-' && i+1 < len(q) && q[i+1] == '-':
+			t = '\n'
+			i++
+		case c == '/' && i+1 < len(q) && q[i+1] == '*':
+			t = '*'
+			i++
+		case c == '?':
+			f(i)
+		case c == '$' && i+1 < len(q) && q[i+1] >= '0' && q[i+1] <= '9':
+			f(i)
+		case c == ':' && i+1 < len(q) && q[i+1] == ':':
+			// Skip type casts, such as '::int', so they are not treated as names.
+			i++
+		case c == ':' && i+1 < len(q) && isIdent(q[i+1], true):
+			f(i)
+		}
+	}
+}
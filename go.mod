@@ -1,3 +1,3 @@
 module github.com/PurpleSec/mapper
 
-go 1.17
+go 1.23
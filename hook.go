@@ -0,0 +1,263 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// StmtStats is a struct that contains the execution counters for a statement.
+// These are only tracked when the 'TrackStats' property of the Map is True.
+//
+// The Duration value is the total time spent in all executions and can be
+// used with the counts to compute an average.
+//
+// The InFlight value is the number of executions currently in progress and is
+// always tracked. For the 'Query' functions, an execution is only counted until
+// the call returns and not while the returned Rows are open.
+//
+// The Tags value contains the tags the statement was added with using the
+// 'AddWithTags' functions and is always set. Statements added without tags
+// will have an empty (non-nil) map.
+type StmtStats struct {
+	Tags     map[string]string
+	Execs    int64
+	Queries  int64
+	Errors   int64
+	InFlight int64
+	Duration time.Duration
+}
+
+// ExecFunc is a function that executes the statement with the provided name
+// using the supplied arguments. The operation will be one of "Exec", "Query" or
+// "QueryRow" and the returned value will be a 'sql.Result', '*sql.Rows' or
+// '*sql.Row' respectively.
+//
+// This is used as the handler type for middleware added with 'Use'.
+type ExecFunc func(x context.Context, name, op string, args []interface{}) (interface{}, error)
+
+// Logger is an interface that can be used to log errors that occur in a Map.
+// This interface is satisfied by '*log.Logger'.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+type tagsKey struct{}
+type counters struct {
+	flight  atomic.Int64
+	execs   atomic.Int64
+	errors  atomic.Int64
+	queries atomic.Int64
+	elapsed atomic.Int64
+}
+
+// Stats returns a snapshot of the execution counters for each statement currently
+// mapped. Any closed statements will be omitted.
+//
+// Counters are only tracked when the 'TrackStats' property of the Map is True,
+// otherwise all the values (except InFlight) will be zero. Query counts include
+// calls to the 'QueryRow' functions.
+func (m *Map) Stats() map[string]StmtStats {
+	if m == nil {
+		return nil
+	}
+	m.lock.RLock()
+	r := make(map[string]StmtStats, len(m.entries))
+	for k, v := range m.entries {
+		if v == nil {
+			continue
+		}
+		t := make(map[string]string, len(v.tags))
+		for n, s := range v.tags {
+			t[n] = s
+		}
+		r[k] = StmtStats{
+			Tags:     t,
+			Execs:    v.stats.execs.Load(),
+			Errors:   v.stats.errors.Load(),
+			Queries:  v.stats.queries.Load(),
+			InFlight: v.stats.flight.Load(),
+			Duration: time.Duration(v.stats.elapsed.Load()),
+		}
+	}
+	m.lock.RUnlock()
+	return r
+}
+
+// UnusedNames returns a list of the names of the statements currently mapped
+// that have not been executed by any of the 'Exec', 'Query' or 'QueryRow'
+// functions (or their Context and Tx variants). This can be used to find dead
+// mappings that can be removed.
+//
+// Executions are only tracked when the 'TrackStats' property of the Map is True,
+// so this returns nil if it is not set. Names created with 'Alias' share their
+// usage with the original statement. The returned slice is in no particular
+// order. Any closed statements will be omitted.
+func (m *Map) UnusedNames() []string {
+	if m == nil || !m.TrackStats {
+		return nil
+	}
+	m.lock.RLock()
+	var r []string
+	for k, v := range m.entries {
+		if v == nil || v.stats.execs.Load() > 0 || v.stats.queries.Load() > 0 {
+			continue
+		}
+		r = append(r, k)
+	}
+	m.lock.RUnlock()
+	return r
+}
+
+// InFlight returns the number of statement executions that are currently in
+// progress across all statements in this Map.
+//
+// For the 'Query' functions, an execution is only counted until the call returns
+// and not while the returned Rows are open.
+func (m *Map) InFlight() int {
+	if m == nil {
+		return 0
+	}
+	return int(m.flight.Load())
+}
+
+// TagsFromContext returns the tags of the statement being executed from the
+// supplied Context. This can be used in the 'Observer' function of a Map to
+// read the tags a statement was added with using the 'AddWithTags' functions.
+//
+// This returns nil if the Context does not contain any tags. The returned map
+// is shared with the statement and must not be modified.
+func TagsFromContext(x context.Context) map[string]string {
+	if x == nil {
+		return nil
+	}
+	t, _ := x.Value(tagsKey{}).(map[string]string)
+	return t
+}
+func (m *Map) enter(e *entry) {
+	m.flight.Add(1)
+	e.stats.flight.Add(1)
+}
+func (m *Map) leave(e *entry) {
+	m.flight.Add(-1)
+	e.stats.flight.Add(-1)
+}
+
+// Use will add the supplied middleware function to the Map. Middleware will be
+// called around every statement execution made with the 'Exec', 'Query' and
+// 'QueryRow' functions (and their Context and Tx variants) and can be used to
+// audit, measure, change the arguments of or short-circuit an execution.
+//
+// Each middleware is given the next handler in the chain, with the last handler
+// executing the statement. Middleware is called in the order it was added, so
+// the first middleware added is the outermost.
+//
+// A middleware that short-circuits should return a value of the type expected
+// by the operation (see 'ExecFunc'), or an error. If a middleware returns a nil
+// value or a value of any other type without an error, an error will be
+// returned to the caller instead.
+func (m *Map) Use(f func(next ExecFunc) ExecFunc) {
+	if m == nil || f == nil {
+		return
+	}
+	m.lock.Lock()
+	if p := m.mw; p != nil {
+		m.mw = func(n ExecFunc) ExecFunc { return p(f(n)) }
+	} else {
+		m.mw = f
+	}
+	m.lock.Unlock()
+}
+func (m *Map) middleware() func(ExecFunc) ExecFunc {
+	m.lock.RLock()
+	f := m.mw
+	m.lock.RUnlock()
+	return f
+}
+func intercept[T any](w func(ExecFunc) ExecFunc, x context.Context, name, op string, args []interface{}, f func(context.Context, string, []interface{}) (T, *entry, error)) (T, *entry, error) {
+	if w == nil {
+		return f(x, name, args)
+	}
+	var e *entry
+	r, err := w(func(x context.Context, name, _ string, args []interface{}) (interface{}, error) {
+		r, v, err := f(x, name, args)
+		e = v
+		return r, err
+	})(x, name, op, args)
+	v, ok := r.(T)
+	if err == nil && (!ok || isNil(r)) {
+		// A middleware returned no value without an error, so there is nothing
+		// safe to return to the caller.
+		return v, e, &errval{s: `middleware for mapping "` + name + `" returned an invalid ` + op + ` result`}
+	}
+	return v, e, err
+}
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	r := reflect.ValueOf(v)
+	return r.Kind() == reflect.Pointer && r.IsNil()
+}
+func (m *Map) hooked() bool {
+	return m != nil && (m.Observer != nil || m.Tracer != nil || m.Logger != nil || m.TrackStats)
+}
+func (m *Map) logf(s string, v ...interface{}) {
+	if m.Logger == nil {
+		return
+	}
+	m.Logger.Printf("mapper: "+s, v...)
+}
+func (m *Map) trace(x context.Context, name, op string) (context.Context, func(*entry, error)) {
+	var (
+		f func(error)
+		t = time.Now()
+	)
+	if m.Tracer != nil {
+		x, f = m.Tracer(x, name, op)
+	}
+	return x, func(e *entry, err error) {
+		m.observe(x, e, name, op, t, err)
+		if f != nil {
+			f(err)
+		}
+	}
+}
+func (m *Map) observe(x context.Context, e *entry, name, op string, t time.Time, err error) {
+	d := time.Since(t)
+	if m.TrackStats && e != nil {
+		if op == "Exec" {
+			e.stats.execs.Add(1)
+		} else {
+			e.stats.queries.Add(1)
+		}
+		if err != nil {
+			e.stats.errors.Add(1)
+		}
+		e.stats.elapsed.Add(int64(d))
+	}
+	if err != nil {
+		m.logf(`error executing %s on mapping "%s": %s`, op, name, err)
+	}
+	if m.Observer != nil {
+		if e != nil && len(e.tags) > 0 {
+			x = context.WithValue(x, tagsKey{}, e.tags)
+		}
+		m.Observer(x, name, op, d, err)
+	}
+}
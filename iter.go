@@ -0,0 +1,88 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"context"
+	"iter"
+	"reflect"
+)
+
+// Iter will return an iterator that will attempt to get the statement with the
+// provided name, call the 'Query' function on the statement and then yield each
+// returned row scanned into a new value of type T.
+//
+// Values are scanned using the same rules as 'QueryStruct'. Any errors will be
+// yielded with a zero value of T, after which the iteration will stop. The query
+// is not run until the iterator is used and the returned Rows are closed when
+// the iteration ends or is stopped early.
+//
+// If the Timeout property of the Map is set, it will apply to each iteration as
+// a whole.
+func Iter[T any](m *Map, name string, args ...interface{}) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		x, f := m.context(name)
+		IterContext[T](m, x, name, args...)(yield)
+		f()
+	}
+}
+
+// IterContext will return an iterator that will attempt to get the statement with
+// the provided name, call the 'Query' function on the statement and then yield
+// each returned row scanned into a new value of type T.
+//
+// Values are scanned using the same rules as 'QueryStruct'. Any errors will be
+// yielded with a zero value of T, after which the iteration will stop. The query
+// is not run until the iterator is used and the returned Rows are closed when
+// the iteration ends or is stopped early.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func IterContext[T any](m *Map, x context.Context, name string, args ...interface{}) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var v T
+		r, err := m.QueryContext(x, name, args...)
+		if err != nil {
+			yield(v, err)
+			return
+		}
+		var s *scanner
+		for r.Next() {
+			if s == nil {
+				if s, err = newScanner[T](r); err != nil {
+					break
+				}
+			}
+			var n T
+			if err = s.scan(r, reflect.ValueOf(&n).Elem()); err != nil {
+				break
+			}
+			if !yield(n, nil) {
+				r.Close()
+				return
+			}
+		}
+		if err == nil {
+			err = r.Err()
+		}
+		if c := r.Close(); err == nil {
+			err = c
+		}
+		if err != nil {
+			yield(v, err)
+		}
+	}
+}
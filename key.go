@@ -0,0 +1,74 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// AddKey is similar to 'Add', but uses the result of the 'String' function of the
+// supplied key as the name.
+//
+// This allows for using enum-like types as statement names, to prevent typos in
+// string names. Statements added with a key can be used with the 'Key' functions
+// or with the normal functions using the key's string value.
+func (m *Map) AddKey(k fmt.Stringer, query string) error {
+	return m.Add(k.String(), query)
+}
+
+// ExecKey is similar to 'Exec', but uses the result of the 'String' function of
+// the supplied key as the name.
+func (m *Map) ExecKey(k fmt.Stringer, args ...interface{}) (sql.Result, error) {
+	return m.Exec(k.String(), args...)
+}
+
+// QueryKey is similar to 'Query', but uses the result of the 'String' function
+// of the supplied key as the name.
+func (m *Map) QueryKey(k fmt.Stringer, args ...interface{}) (*sql.Rows, error) {
+	return m.Query(k.String(), args...)
+}
+
+// QueryRowKey is similar to 'QueryRow', but uses the result of the 'String'
+// function of the supplied key as the name.
+func (m *Map) QueryRowKey(k fmt.Stringer, args ...interface{}) (*sql.Row, bool) {
+	return m.QueryRow(k.String(), args...)
+}
+
+// AddKeyContext is similar to 'AddContext', but uses the result of the 'String'
+// function of the supplied key as the name.
+func (m *Map) AddKeyContext(x context.Context, k fmt.Stringer, query string) error {
+	return m.AddContext(x, k.String(), query)
+}
+
+// ExecKeyContext is similar to 'ExecContext', but uses the result of the 'String'
+// function of the supplied key as the name.
+func (m *Map) ExecKeyContext(x context.Context, k fmt.Stringer, args ...interface{}) (sql.Result, error) {
+	return m.ExecContext(x, k.String(), args...)
+}
+
+// QueryKeyContext is similar to 'QueryContext', but uses the result of the
+// 'String' function of the supplied key as the name.
+func (m *Map) QueryKeyContext(x context.Context, k fmt.Stringer, args ...interface{}) (*sql.Rows, error) {
+	return m.QueryContext(x, k.String(), args...)
+}
+
+// QueryRowKeyContext is similar to 'QueryRowContext', but uses the result of
+// the 'String' function of the supplied key as the name.
+func (m *Map) QueryRowKeyContext(x context.Context, k fmt.Stringer, args ...interface{}) (*sql.Row, bool) {
+	return m.QueryRowContext(x, k.String(), args...)
+}
@@ -0,0 +1,174 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Decoder is an interface that matches the 'Decode' function of decoders such as
+// 'json.Decoder' or the 'yaml.Decoder' from "gopkg.in/yaml.v3", which can be used
+// to load mappings from any supported format.
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// AddJSON will decode a JSON object of names to queries from the supplied Reader
+// and will prepare and add them to the Map using 'Extend'.
+//
+// Decoding errors are returned before any queries are prepared and are wrapped
+// separately from any errors returned by 'Extend'.
+func (m *Map) AddJSON(r io.Reader) error {
+	return m.AddDecoderContext(context.Background(), json.NewDecoder(r))
+}
+
+// AddDecoder will decode a map of names to queries from the supplied Decoder and
+// will prepare and add them to the Map using 'Extend'. This can be used to load
+// mappings from YAML or any other format with a compatible Decoder.
+//
+// Decoding errors are returned before any queries are prepared and are wrapped
+// separately from any errors returned by 'Extend'.
+func (m *Map) AddDecoder(d Decoder) error {
+	return m.AddDecoderContext(context.Background(), d)
+}
+
+// AddFS will prepare and add all the files in the supplied filesystem that match
+// the provided glob pattern. Each file's contents will be used as the query and
+// the base name of the file, without the extension, will be used as the name.
+//
+// The glob pattern uses the same syntax as 'fs.Glob'. Files are added in lexical
+// order and this function will stop and return any errors that occur.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+func (m *Map) AddFS(f fs.FS, glob string) error {
+	return m.AddFSContext(context.Background(), f, glob)
+}
+
+// AddFSContext will prepare and add all the files in the supplied filesystem that
+// match the provided glob pattern. Each file's contents will be used as the query
+// and the base name of the file, without the extension, will be used as the name.
+//
+// The glob pattern uses the same syntax as 'fs.Glob'. Files are added in lexical
+// order and this function will stop and return any errors that occur.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) AddFSContext(x context.Context, f fs.FS, glob string) error {
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	l, err := fs.Glob(f, glob)
+	if err != nil {
+		return &errval{e: err, s: `error matching "` + glob + `"`}
+	}
+	for i := range l {
+		d, err := fs.ReadFile(f, l[i])
+		if err != nil {
+			return &errval{e: err, s: `error reading file "` + l[i] + `"`}
+		}
+		n := path.Base(l[i])
+		if err = m.AddContext(x, strings.TrimSuffix(n, path.Ext(n)), string(d)); err != nil {
+			return &errval{e: err, s: `error adding file "` + l[i] + `"`}
+		}
+	}
+	return nil
+}
+
+// AddJSONContext will decode a JSON object of names to queries from the supplied
+// Reader and will prepare and add them to the Map using 'ExtendContext'.
+//
+// Decoding errors are returned before any queries are prepared and are wrapped
+// separately from any errors returned by 'ExtendContext'.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) AddJSONContext(x context.Context, r io.Reader) error {
+	return m.AddDecoderContext(x, json.NewDecoder(r))
+}
+
+// AddDecoderContext will decode a map of names to queries from the supplied
+// Decoder and will prepare and add them to the Map using 'ExtendContext'. This
+// can be used to load mappings from YAML or any other format with a compatible
+// Decoder.
+//
+// Decoding errors are returned before any queries are prepared and are wrapped
+// separately from any errors returned by 'ExtendContext'.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) AddDecoderContext(x context.Context, d Decoder) error {
+	var v map[string]string
+	if err := d.Decode(&v); err != nil {
+		return &errval{e: err, s: "error decoding mappings"}
+	}
+	return m.ExtendContext(x, v)
+}
+
+// Dump will write the name and query text of every statement in the Map to the
+// supplied Writer, sorted by name. Each statement is written as a "-- name"
+// comment line followed by the query and a terminating semicolon.
+//
+// Any closed statements will be omitted.
+func (m *Map) Dump(w io.Writer) error {
+	v := m.sources()
+	n := make([]string, 0, len(v))
+	for k := range v {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	for i := range n {
+		q := strings.TrimRight(strings.TrimSpace(v[n[i]]), ";")
+		if _, err := io.WriteString(w, "-- "+n[i]+"\n"+q+";\n\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DumpJSON will write a JSON object of the name and query text of every statement
+// in the Map to the supplied Writer, sorted by name. The output can be loaded
+// using 'AddJSON'.
+//
+// Any closed statements will be omitted.
+func (m *Map) DumpJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(m.sources())
+}
+func (m *Map) sources() map[string]string {
+	if m == nil {
+		return nil
+	}
+	m.lock.RLock()
+	r := make(map[string]string, len(m.entries))
+	for k, v := range m.entries {
+		if v != nil {
+			r[k] = v.query
+		}
+	}
+	m.lock.RUnlock()
+	return r
+}
@@ -18,22 +18,230 @@ package mapper
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// ErrInvalidDB is an error returned when the Database property of the Map is nil.
-var ErrInvalidDB = &errval{s: "database cannot be nil"}
+var (
+	// ErrNotFound is an error returned when a statement with the requested name
+	// does not exist. This error is wrapped with the requested name and can be
+	// checked using 'errors.Is'.
+	ErrNotFound = &errval{s: "statement does not exist"}
+	// ErrInvalidDB is an error returned when the Map or the Database property of
+	// the Map is nil.
+	ErrInvalidDB = &errval{s: "database cannot be nil"}
+	// ErrDuplicateName is an error returned when a statement is added with a name
+	// that is already mapped. This error is wrapped with the conflicting name and
+	// can be checked using 'errors.Is'.
+	ErrDuplicateName = &errval{s: "statement already exists"}
+	// ErrClosed is an error returned when attempting to use or add statements to
+	// a Map after 'Close' has closed the Database, or when the Database has been
+	// closed elsewhere.
+	ErrClosed = &errval{s: "map is closed"}
+)
 
 // Map is a struct that is used to track and manage multiple database *Stmt structs.
 // Each statement can be mapped to a name that can be used again to recall or execute
 // the statement.
 //
-// This struct is safe for multiple co-current goroutine usage.
+// This struct is safe for multiple co-current goroutine usage. Functions can also
+// be called on a nil Map, where any read functions will return empty values and
+// any other functions will return 'ErrInvalidDB'.
 type Map struct {
 	lock sync.RWMutex
 
-	Database *sql.DB
-	entries  map[string]*sql.Stmt
+	// Database is the Database used to prepare and execute statements.
+	//
+	// After a call to 'SwapDatabase' or 'Reset', the Map uses the new Database
+	// (returned by 'DB') and this property is left unchanged, as it may be read
+	// by concurrent calls. Assigning this property again afterwards replaces the
+	// swapped Database.
+	Database  *sql.DB
+	entries   map[string]*entry
+	tick      atomic.Int64
+	flight    atomic.Int64
+	mw        func(ExecFunc) ExecFunc
+	templates map[string]*tmpl
+	closed    atomic.Bool
+	timed     atomic.Bool
+	active    atomic.Pointer[swapped]
+	one       atomic.Pointer[single]
+
+	// ReadDatabase is an optional secondary Database, such as a read replica.
+	// When set, each statement will also be prepared against this Database and
+	// the 'Query' and 'QueryRow' functions (and their variants) will use it,
+	// while the 'Exec' functions will always use the primary Database.
+	//
+	// This must be set before any statements are added, as statements are
+	// prepared on both Databases when added. This Database will also be closed
+	// by 'Close' unless 'KeepDatabaseOpen' is True.
+	ReadDatabase *sql.DB
+
+	// Observer is an optional function that will be called after every statement
+	// execution made with the 'Exec', 'Query' and 'QueryRow' functions (and their
+	// Context variants) with the statement name, the operation ("Exec", "Query"
+	// or "QueryRow"), the time taken and the resulting error.
+	//
+	// The supplied Context is the one used for the execution, so any request
+	// scoped values (such as trace or user IDs) can be read from it. This
+	// includes any values added by the 'Tracer' function, if set. The tags of
+	// the statement, if any, can be read using 'TagsFromContext'.
+	//
+	// This function is called synchronously, so it should return quickly.
+	Observer func(x context.Context, name, op string, d time.Duration, err error)
+
+	// Timeout is an optional duration that will be used as a deadline for calls
+	// to the non-Context execution functions, such as 'Exec', 'Query' and
+	// 'QueryRow'. A value of zero (the default) disables the timeout.
+	//
+	// Statements added with the 'AddWithTimeout' functions use their own timeout
+	// instead of this one. The Context variants of the functions will never have
+	// either timeout applied, so any deadline set on the supplied Context by the
+	// caller takes priority. Rows returned by 'Query' must be read before the
+	// Timeout expires.
+	Timeout time.Duration
+	// Tracer is an optional function that will be called before every statement
+	// execution made with the 'Exec', 'Query' and 'QueryRow' functions (and their
+	// Context variants) with the statement name and the operation. The returned
+	// Context will be used for the execution and the returned function, if not
+	// nil, will be called with the resulting error once the execution completes.
+	//
+	// This can be used to create tracing spans (such as with OpenTelemetry)
+	// without this package depending on a tracing library.
+	Tracer func(x context.Context, name, op string) (context.Context, func(error))
+	// Logger is an optional Logger that will be used to log any errors that occur
+	// when preparing statements or during statement executions. A '*log.Logger'
+	// can be used here. This does not change any returned errors.
+	Logger Logger
+	// Dialect is the placeholder style used by the Database driver. When set to
+	// a value other than 'DialectDefault', any '?' placeholders in queries will
+	// be rewritten to the Dialect's style before they are prepared. Placeholders
+	// inside quoted strings and comments are not changed.
+	//
+	// The query text returned by 'Source' is the query before it is rewritten.
+	Dialect Dialect
+	// TrackStats can be set to True to enable tracking execution counters for
+	// each statement, which can be retrieved using the 'Stats' function. This also
+	// enables reporting statements that were never executed using 'UnusedNames'.
+	TrackStats bool
+	// MaxEntries is an optional limit on the number of statements in the Map.
+	// When a statement is added that would exceed this limit, the least recently
+	// used statement will be closed and removed. A value of zero (the default)
+	// means the Map is unbounded.
+	//
+	// This is useful when statements are added dynamically, to prevent leaking
+	// prepared statements.
+	MaxEntries int
+	// KeepDatabaseOpen can be set to True to prevent 'Close' from closing the
+	// Database. This is useful when the Database is shared by multiple Maps.
+	KeepDatabaseOpen bool
+	// Passthrough can be set to True to disable the use of prepared statements.
+	// When enabled, adding a statement will only store the query text and the
+	// execution functions will run the query directly against the Database.
+	//
+	// This is useful for drivers or connection poolers (such as pgbouncer in
+	// transaction pooling mode) that do not support prepared statements. The
+	// statement returned by 'Get' and 'GetOrAdd' (and passed to 'Range') will be
+	// nil in this mode. This must be set before any statements are added.
+	Passthrough bool
+	// ValidateArgs can be set to True to check the number of arguments passed
+	// to the 'Exec', 'Query' and 'QueryRow' functions (and their Context and Tx
+	// variants) against the number of placeholders in the query before it is
+	// executed. A mismatch will return an error without calling the Database.
+	//
+	// Only '?' and numbered '$n' placeholders are counted. Placeholders inside
+	// quoted strings and comments are ignored.
+	ValidateArgs bool
+	// RetryPolicy is an optional policy that will be used to automatically retry
+	// the 'Exec' and 'Query' functions (and their Context variants) when they
+	// fail with a transient error. See 'RetryPolicy' for more details.
+	RetryPolicy *RetryPolicy
+	// Strict can be set to True to return an error when the 'Exec' functions are
+	// used with a statement that returns rows (such as 'SELECT' or 'WITH') or
+	// when the 'Query' and 'QueryRow' functions are used with an 'INSERT',
+	// 'UPDATE' or 'DELETE' statement without a 'RETURNING' clause. This applies
+	// to the Context and Tx variants as well.
+	//
+	// Statements that do not start with one of these keywords are not checked.
+	Strict bool
+	// Lazy can be set to True to delay preparing statements until they are first
+	// used. When enabled, adding a statement will only store the query text and
+	// the first execution of each statement will prepare it. Concurrent first
+	// executions will only prepare the statement once.
+	//
+	// This makes adding many statements cheaper, but prepare errors will only be
+	// returned when the statement is first used. The statement returned by 'Get'
+	// (and passed to 'Range') will be nil until it has been prepared. This does
+	// not apply to 'AddOrReplace', 'AddPooled' or 'GetOrAdd'.
+	Lazy bool
+	// OnRemove is an optional function that will be called with the name of a
+	// statement after it has been removed and closed by 'Remove', 'RemoveAll',
+	// 'RemovePrefix' or when it is evicted due to 'MaxEntries'. This is not
+	// called for mappings of statements that were already closed.
+	//
+	// This function is called without holding the Map lock, so it may use the
+	// Map. When called due to an eviction, it is called in a new goroutine.
+	OnRemove func(name string)
+	// RowsWarning is an optional duration used by Rows returned from the
+	// 'QueryManaged' functions. When set, a warning will be logged using the
+	// Logger for any Rows that are left open for longer than this duration. A
+	// value of zero (the default) disables the warning.
+	//
+	// Managed Rows that are garbage collected without being closed will always
+	// be logged and closed.
+	RowsWarning time.Duration
+	// MapStrings controls how '[]byte' column values are returned by the
+	// 'QueryMaps' and 'QueryAll' functions. When True, '[]byte' values will be
+	// converted to strings. The default (False) returns them as-is, which keeps
+	// any binary column data intact.
+	MapStrings bool
+}
+
+type swapped struct {
+	base, db *sql.DB
+}
+type single struct {
+	e          *entry
+	stmt, read *sql.Stmt
+	name       string
+}
+
+// NameQuery is a struct that contains a statement name and query pair. This is
+// used by the 'AddOrdered' function to add statements in a specific order.
+type NameQuery struct {
+	Name  string
+	Query string
+}
+type entry struct {
+	conn    *sql.Conn
+	stmt    *sql.Stmt
+	read    *sql.Stmt
+	query   string
+	text    string
+	pool    []*sql.Stmt
+	params  []string
+	args    int
+	kind    uint8
+	lazy    bool
+	refs    int
+	cols    []string
+	tags    map[string]string
+	timeout time.Duration
+	next    atomic.Uint32
+	checked atomic.Bool
+	stats   counters
+	last    atomic.Int64
+	mu      sync.Mutex
+}
+type runner interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
 }
 type errval struct {
 	e error
@@ -42,10 +250,124 @@ type errval struct {
 
 // Len returns the size of the internal mapping.
 func (m *Map) Len() int {
-	if m.entries == nil {
+	if m == nil {
+		return 0
+	}
+	m.lock.RLock()
+	n := len(m.entries)
+	m.lock.RUnlock()
+	return n
+}
+
+// OpenLen returns the number of statements in the internal mapping that are still
+// open.
+//
+// This differs from 'Len' as it does not count any statements that were closed
+// by a call to 'Close', which can be used to check if a previous failed 'Close'
+// call has left any statements open.
+func (m *Map) OpenLen() int {
+	if m == nil {
 		return 0
 	}
-	return len(m.entries)
+	var n int
+	m.lock.RLock()
+	for _, v := range m.entries {
+		if v != nil {
+			n++
+		}
+	}
+	m.lock.RUnlock()
+	return n
+}
+
+// Healthy returns True if the Map is fully usable, which is when the Database
+// is not nil, the Map has not been closed, at least one statement has been added
+// and none of the statements have been closed by a call to 'Close'.
+//
+// This does not make any calls to the Database, so it can be used as a quick
+// readiness check. Use 'Ping' to check that the Database is reachable.
+func (m *Map) Healthy() bool {
+	if m == nil || m.database() == nil || m.closed.Load() {
+		return false
+	}
+	m.lock.RLock()
+	r := len(m.entries) > 0
+	for _, v := range m.entries {
+		if v == nil {
+			r = false
+			break
+		}
+	}
+	m.lock.RUnlock()
+	return r
+}
+
+// Initialized returns True if any statements have been added to this Map or if
+// it has been cleared using 'Clear'.
+//
+// This can be used to distinguish a Map that was never used from a Map that had
+// all of its statements removed, as 'Len' returns zero for both.
+func (m *Map) Initialized() bool {
+	if m == nil {
+		return false
+	}
+	m.lock.RLock()
+	r := m.entries != nil
+	m.lock.RUnlock()
+	return r
+}
+
+// Names returns a list of all the names of the statements currently mapped.
+//
+// The returned slice is a copy and is in no particular order. Any closed
+// statements will be omitted.
+func (m *Map) Names() []string {
+	if m == nil {
+		return nil
+	}
+	m.lock.RLock()
+	r := make([]string, 0, len(m.entries))
+	for k, v := range m.entries {
+		if v == nil {
+			continue
+		}
+		r = append(r, k)
+	}
+	m.lock.RUnlock()
+	return r
+}
+
+// Range will call the supplied function for each statement currently mapped,
+// in no particular order. Iteration will stop early if the function returns
+// False. Any closed statements will be skipped.
+//
+// The mappings are copied before any calls are made, so the function may
+// safely call any other Map functions.
+func (m *Map) Range(f func(name string, s *sql.Stmt) bool) {
+	if m == nil {
+		return
+	}
+	m.lock.RLock()
+	if len(m.entries) == 0 {
+		m.lock.RUnlock()
+		return
+	}
+	var (
+		n = make([]string, 0, len(m.entries))
+		e = make([]*sql.Stmt, 0, len(m.entries))
+	)
+	for k, v := range m.entries {
+		if v == nil {
+			continue
+		}
+		n, e = append(n, k), append(e, v.stmt)
+	}
+	m.lock.RUnlock()
+	for i := range n {
+		if !f(n[i], e[i]) {
+			return
+		}
+	}
 }
 
 // New is a shorthand function for "&Map{database: db}". Returns a new Map instance
@@ -54,175 +376,1953 @@ func New(db *sql.DB) *Map {
 	return &Map{Database: db}
 }
 
-// Close will attempt to close all the contained database statements.
-// This will bail on any errors that occur.
+// Clone will create a new Map that uses the same Database and settings as this
+// Map and contains the same mappings. Each query will be prepared again, so the
+// statements of the new Map are independent of this Map.
 //
-// Multiple calls to close can be used to make sure that all statements are
-// closed successfully. Note: this will also attempt to close the connected
-// database if all statement closures are successful.
-func (m *Map) Close() error {
-	var err error
-	if m.lock.Lock(); m.entries != nil {
-		for k, v := range m.entries {
-			if v == nil {
-				continue
+// Pooled statements keep their pool size, names created with 'Alias' will point
+// to the same cloned statement as their target and any expected columns, tags
+// and timeouts are kept.
+//
+// If any of the queries fail to prepare, the error will be returned and any
+// statements prepared for the new Map will be closed.
+//
+// Note: both Maps will share the same Database, so 'KeepDatabaseOpen' should be
+// set on at least one of them if they will be closed separately.
+func (m *Map) Clone() (*Map, error) {
+	return m.CloneContext(context.Background())
+}
+
+// CloneContext will create a new Map that uses the same Database and settings as
+// this Map and contains the same mappings. Each query will be prepared again, so
+// the statements of the new Map are independent of this Map.
+//
+// Pooled statements keep their pool size, names created with 'Alias' will point
+// to the same cloned statement as their target and any expected columns, tags
+// and timeouts are kept.
+//
+// If any of the queries fail to prepare, the error will be returned and any
+// statements prepared for the new Map will be closed.
+//
+// Note: both Maps will share the same Database, so 'KeepDatabaseOpen' should be
+// set on at least one of them if they will be closed separately.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) CloneContext(x context.Context) (*Map, error) {
+	if m == nil || m.database() == nil {
+		return nil, ErrInvalidDB
+	}
+	n := &Map{
+		Timeout:          m.Timeout,
+		Database:         m.database(),
+		ReadDatabase:     m.ReadDatabase,
+		Logger:           m.Logger,
+		Dialect:          m.Dialect,
+		Tracer:           m.Tracer,
+		Observer:         m.Observer,
+		TrackStats:       m.TrackStats,
+		MaxEntries:       m.MaxEntries,
+		KeepDatabaseOpen: m.KeepDatabaseOpen,
+		Passthrough:      m.Passthrough,
+		ValidateArgs:     m.ValidateArgs,
+		RetryPolicy:      m.RetryPolicy,
+		Strict:           m.Strict,
+		Lazy:             m.Lazy,
+		OnRemove:         m.OnRemove,
+		RowsWarning:      m.RowsWarning,
+		MapStrings:       m.MapStrings,
+		mw:               m.middleware(),
+	}
+	m.lock.RLock()
+	n.entries = make(map[string]*entry, len(m.entries))
+	var (
+		c   = make(map[*entry]*entry, len(m.entries))
+		err error
+	)
+	for k, v := range m.entries {
+		if v == nil {
+			continue
+		}
+		if err = x.Err(); err != nil {
+			break
+		}
+		// Aliases share the entry of their target, so they are linked to the
+		// cloned entry instead of being prepared again.
+		if e, ok := c[v]; ok {
+			e.refs++
+			n.store(k, e)
+			continue
+		}
+		var e *entry
+		if len(v.pool) > 0 {
+			// Pooled statements are never Lazy, which matches 'AddPooled'.
+			if e, err = n.prepare(x, nil, k, v.query); err == nil {
+				if err = n.fill(x, e, k, len(v.pool)+1); err != nil {
+					e.close()
+				}
 			}
-			if err = v.Close(); err != nil {
-				err = &errval{e: err, s: `closing mapping "` + k + `"`}
+			if err != nil {
+				err = &errval{e: err, s: `error adding mapping "` + k + `"`}
 				break
 			}
-			m.entries[k] = nil
+		} else if e, err = n.create(x, v.conn, k, v.query, v.params); err != nil {
+			break
 		}
+		e.cols, e.tags, e.timeout = v.cols, v.tags, v.timeout
+		if n.store(k, e); v.timeout > 0 {
+			n.timed.Store(true)
+		}
+		c[v] = e
 	}
-	if m.lock.Unlock(); err != nil {
-		return err
+	for k, v := range m.templates {
+		if n.templates == nil {
+			n.templates = make(map[string]*tmpl, len(m.templates))
+		}
+		n.templates[k] = &tmpl{t: v.t}
+	}
+	if m.lock.RUnlock(); err != nil {
+		n.close()
+		return nil, err
 	}
-	return m.Database.Close()
+	return n, nil
 }
-func (e errval) Error() string {
-	if e.e == nil {
-		return e.s
+
+// DB returns the Database currently used by the Map. This is the 'Database'
+// property, unless it was replaced by a call to 'SwapDatabase' or 'Reset'. This
+// is also the Database that will be closed by 'Close'.
+func (m *Map) DB() *sql.DB {
+	if m == nil {
+		return nil
 	}
-	return e.s + ": " + e.e.Error()
+	return m.database()
 }
-func (e errval) Unwrap() error {
-	return e.e
+
+// Ping will verify that the connection to the Database is still alive.
+//
+// This will return 'ErrInvalidDB' if the Database is nil.
+func (m *Map) Ping() error {
+	return m.PingContext(context.Background())
 }
 
-// Remove will attempt to remove the statement with the provided name.
+// PingContext will verify that the connection to the Database is still alive.
 //
-// This function will return True if the mapping was found and removed.
-// Otherwise the function will return false.
+// This will return 'ErrInvalidDB' if the Database is nil.
 //
-// This will also close the removed statement.
-func (m *Map) Remove(name string) bool {
-	if m.entries == nil {
-		return false
-	}
-	s, ok := m.entries[name]
-	if !ok {
-		return false
+// This function specifies a Context that can be used to interrupt and cancel the
+// Ping function.
+func (m *Map) PingContext(x context.Context) error {
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
 	}
-	m.lock.Lock()
-	s.Close()
-	delete(m.entries, name)
-	m.lock.Unlock()
-	return true
+	return m.database().PingContext(x)
 }
 
-// Contains returns True if the name provided has an associated statement.
-func (m *Map) Contains(name string) bool {
-	if len(m.entries) == 0 {
-		return false
+// Warmup will attempt to prepare all the statements on the specified number of
+// pooled connections, so the first calls made on those connections do not need
+// to prepare the statements.
+//
+// This is best-effort and its effectiveness is driver-dependent. The number of
+// connections will be limited to the maximum number of open connections of the
+// Database, if one is set.
+func (m *Map) Warmup(conns int) error {
+	return m.WarmupContext(context.Background(), conns)
+}
+
+// WarmupContext will attempt to prepare all the statements on the specified
+// number of pooled connections, so the first calls made on those connections do
+// not need to prepare the statements.
+//
+// This is best-effort and its effectiveness is driver-dependent. The number of
+// connections will be limited to the maximum number of open connections of the
+// Database, if one is set.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) WarmupContext(x context.Context, conns int) error {
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	if conns <= 0 {
+		return nil
+	}
+	if n := m.database().Stats().MaxOpenConnections; n > 0 && conns > n {
+		conns = n
 	}
 	m.lock.RLock()
-	s, ok := m.entries[name]
+	l := make([]*sql.Stmt, 0, len(m.entries))
+	for _, v := range m.entries {
+		if v != nil && v.stmt != nil {
+			l = append(l, v.stmt)
+		}
+	}
 	m.lock.RUnlock()
-	return ok && s != nil
+	if len(l) == 0 {
+		return nil
+	}
+	var (
+		t   = make([]*sql.Tx, 0, conns)
+		err error
+	)
+	// Each Transaction holds a separate connection until it is rolled back,
+	// which forces each statement to be prepared on a distinct connection.
+	for i := 0; i < conns; i++ {
+		var v *sql.Tx
+		if v, err = m.database().BeginTx(x, nil); err != nil {
+			err = &errval{e: err, s: "error starting transaction"}
+			break
+		}
+		for n := range l {
+			v.StmtContext(x, l[n])
+		}
+		t = append(t, v)
+	}
+	for i := range t {
+		t[i].Rollback()
+	}
+	return err
 }
 
-// Add will prepare and add the specified query to the Map with the provided name.
+// Close will attempt to close all the contained database statements.
+// This will attempt to close every statement and will return all the errors
+// that occur joined together.
 //
-// This will only add the mapping if the 'Prepare' function is successful. Otherwise
-// the prepare error will be returned.
+// Multiple calls to close can be used to make sure that all statements are
+// closed successfully, as any statements closed successfully will not be
+// closed again. Note: this will also attempt to close the connected database,
+// even if some of the statement closures failed, unless 'KeepDatabaseOpen' is
+// True.
 //
-// This function does not allow for adding a mapping when one already exists. If
-// a mapping with an overlapping name is attempted, an error will be returned before
-// attempting to prepare the query.
-func (m *Map) Add(name, query string) error {
-	return m.AddContext(context.Background(), name, query)
+// This function is safe to call concurrently and is idempotent. The connected
+// database will only be closed by the first call, so once all the statements
+// and the database are closed, any further calls will return nil. Once the
+// database is closed, any attempts to add or use statements will return
+// 'ErrClosed'.
+func (m *Map) Close() error {
+	if m == nil {
+		return ErrInvalidDB
+	}
+	m.acquire()
+	err := m.close()
+	d := m.closing()
+	if m.release(); !d {
+		return err
+	}
+	return join(err, m.closeDB())
 }
 
-// Batch is a function that can be used to perform execute statements in a specific
-// order.
+// CloseContext will attempt to close all the contained database statements.
+// This will attempt to close every statement and will return all the errors
+// that occur joined together.
 //
-// This function will execute all the statements in the provided string array and
-// will stop and return any errors that occur.
+// This function differs from 'Close' as it will stop and return the Context
+// error if the Context is cancelled or expires before all the statements (and
+// the connected database) are closed. Any statements that were not closed will
+// be kept, so a later call can attempt to close them again. A statement that was
+// still being closed when the Context expired is removed from use and will
+// continue to be closed in the background.
 //
-// The passed query results will not be returned or parsed.
-func (m *Map) Batch(queries []string) error {
-	return m.BatchContext(context.Background(), queries)
+// Like 'Close', the connected database will only be closed once, so any calls
+// made after everything has been closed will return nil.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// close calls.
+func (m *Map) CloseContext(x context.Context) error {
+	if m == nil {
+		return ErrInvalidDB
+	}
+	var (
+		r   []error
+		err error
+	)
+	m.acquire()
+	for k, v := range m.entries {
+		if v == nil {
+			continue
+		}
+		// The statements are detached from the entry before closing them, so a
+		// close that is still running after the Context expires does not race
+		// with any calls that replace the statements of the entry.
+		c := &entry{stmt: v.stmt, read: v.read, pool: v.pool}
+		m.entries[k] = nil
+		if err = wait(x, c.close); err == x.Err() && err != nil {
+			break
+		}
+		if err != nil {
+			// Keep the entry so a later call can attempt to close it again.
+			m.entries[k] = v
+			r, err = append(r, &errval{e: err, s: `closing mapping "` + k + `"`}), nil
+		}
+	}
+	var d bool
+	if err == nil {
+		if v := m.closeTemplates(); v != nil {
+			r = append(r, v)
+		}
+		d = m.closing()
+	}
+	if m.release(); err != nil {
+		return err
+	}
+	if !d {
+		return errors.Join(r...)
+	}
+	if err = wait(x, m.closeDB); err != nil && err == x.Err() {
+		return err
+	}
+	return join(errors.Join(r...), err)
 }
 
-// Get will attempt to return the statement that is associated with the provided
-// name.
+// Clear will attempt to close all the contained database statements and remove
+// them from the Map. This will attempt to close every statement and will return
+// all the errors that occur joined together.
 //
-// This function will return the statement and True if the mapping exists. Otherwise,
-// the statement will be nil and the boolean will be False.
-func (m *Map) Get(name string) (*sql.Stmt, bool) {
-	if len(m.entries) == 0 {
-		return nil, false
+// Unlike 'Close', this will not close the connected database, so the Map can be
+// used again to add new statements. The mappings will only be removed if all the
+// statement closures are successful.
+func (m *Map) Clear() error {
+	if m == nil {
+		return ErrInvalidDB
 	}
-	m.lock.RLock()
-	s, ok := m.entries[name]
-	m.lock.RUnlock()
-	return s, ok
+	m.acquire()
+	err := m.close()
+	if err == nil {
+		m.entries = make(map[string]*entry)
+	}
+	m.release()
+	return err
 }
 
-// Extend will prepare and add all the specified queries in the provided map to
-// the Map.
+// Reset will remove all the mappings from the Map and set the Database to the
+// supplied Database, returning the Map to a usable blank state. This can be used
+// to reuse a Map after it has been closed.
 //
-// This will only add each mapping if the 'Prepare' function is successful. Otherwise
-// the prepare error will be returned.
+// Any statements that are still open will be closed, but the previous Database
+// will not be closed. Any errors from closing the statements are ignored.
 //
-// This function does not allow for adding a mapping when one already exists. If
-// a mapping with an overlapping name is attempted, an error will be returned before
-// attempting to prepare the query.
-func (m *Map) Extend(data map[string]string) error {
-	return m.ExtendContext(context.Background(), data)
+// The 'Database' property is not modified by this call, as it may be read by
+// concurrent calls. The new Database can be retrieved with 'DB'.
+func (m *Map) Reset(db *sql.DB) {
+	if m == nil {
+		return
+	}
+	m.acquire()
+	e := m.entries
+	m.closeTemplates()
+	// The Database field is read without the lock, so the new Database is
+	// stored atomically in the same way as 'SwapDatabase'.
+	m.entries, m.templates = nil, nil
+	m.active.Store(&swapped{base: m.Database, db: db})
+	m.closed.Store(false)
+	m.release()
+	for _, v := range e {
+		if v != nil {
+			v.close()
+		}
+	}
 }
 
-// AddContext will prepare and add the specified query to the Map with the provided
-// name.
+// SwapDatabase will prepare all the statements in the Map against the supplied
+// Database and, if all of them are prepared successfully, will replace the
+// Database and the statements of the Map. The previous statements are closed
+// after the swap, but the previous Database is not closed.
 //
-// This will only add the mapping if the 'Prepare' function is successful. Otherwise
-// the prepare error will be returned.
+// If any of the statements fail to prepare, the error will be returned and the
+// Map will be left unchanged. Statements added with 'AddConn' and statements
+// that have not been prepared yet (when 'Lazy' is True) are not changed. The
+// 'ReadDatabase' is also not changed.
 //
-// This function does not allow for adding a mapping when one already exists. If
-// a mapping with an overlapping name is attempted, an error will be returned before
-// attempting to prepare the query.
+// The 'Database' property is not modified by this call, as it may be read by
+// concurrent calls. The Database in use (which will be closed by 'Close') can
+// be retrieved with 'DB'.
+func (m *Map) SwapDatabase(db *sql.DB) error {
+	return m.SwapDatabaseContext(context.Background(), db)
+}
+
+// SwapDatabaseContext will prepare all the statements in the Map against the
+// supplied Database and, if all of them are prepared successfully, will replace
+// the Database and the statements of the Map. The previous statements are closed
+// after the swap, but the previous Database is not closed.
+//
+// If any of the statements fail to prepare, the error will be returned and the
+// Map will be left unchanged. Statements added with 'AddConn' and statements
+// that have not been prepared yet (when 'Lazy' is True) are not changed. The
+// 'ReadDatabase' is also not changed.
+//
+// The 'Database' property is not modified by this call, as it may be read by
+// concurrent calls. The Database in use (which will be closed by 'Close') can
+// be retrieved with 'DB'.
+//
+// The Map is locked during this call, so any other calls will wait until all the
+// statements are prepared.
 //
 // This function specifies a Context that can be used to interrupt and cancel the
 // prepare calls.
-func (m *Map) AddContext(x context.Context, name, query string) error {
-	if m.Database == nil {
+func (m *Map) SwapDatabaseContext(x context.Context, db *sql.DB) error {
+	if m == nil || db == nil {
 		return ErrInvalidDB
 	}
-	if m.entries == nil {
-		m.entries = make(map[string]*sql.Stmt, 1)
+	var (
+		n   = make(map[*entry][]*sql.Stmt)
+		err error
+	)
+	m.acquire()
+	for k, v := range m.entries {
+		if v == nil || v.conn != nil || v.stmt == nil {
+			continue
+		}
+		if _, ok := n[v]; ok {
+			continue
+		}
+		var (
+			q = m.Dialect.rewrite(v.query)
+			l = make([]*sql.Stmt, 0, len(v.pool)+1)
+		)
+		for i := 0; i <= len(v.pool); i++ {
+			var s *sql.Stmt
+			if s, err = db.PrepareContext(x, q); err != nil {
+				break
+			}
+			l = append(l, s)
+		}
+		if n[v] = l; err != nil {
+			err = &errval{e: err, s: `error preparing mapping "` + k + `"`}
+			break
+		}
 	}
-	m.lock.Lock()
-	if s, ok := m.entries[name]; ok && s != nil {
-		m.lock.Unlock()
-		return &errval{s: `statement with name "` + name + `" already exists`}
+	if err != nil {
+		m.release()
+		for _, l := range n {
+			for i := range l {
+				l[i].Close()
+			}
+		}
+		return err
 	}
-	s, err := m.Database.PrepareContext(x, query)
-	if err == nil {
-		m.entries[name] = s
-	} else {
-		err = &errval{e: err, s: `error adding mapping "` + name + `"`}
+	o := make([]*sql.Stmt, 0, len(n))
+	for e, l := range n {
+		o = append(append(o, e.stmt), e.pool...)
+		if e.stmt = l[0]; len(l) > 1 {
+			e.pool = l[1:]
+		}
 	}
-	m.lock.Unlock()
-	return err
+	m.closeTemplates()
+	// The Database field is read without the lock, so the new Database is only
+	// stored atomically.
+	m.active.Store(&swapped{base: m.Database, db: db})
+	m.release()
+	for i := range o {
+		o[i].Close()
+	}
+	return nil
 }
 
-// BatchContext is a function that can be used to perform execute statements in a
-// specific order. This function will execute all the statements in the provided
-// string array and will stop and return any errors that occur.
+// Shrink will release any excess capacity held by the Map after many statements
+// have been removed. This copies the mappings into a new internal map sized to
+// the number of open statements.
 //
-// The passed query results will not be returned or parsed.
-//
-// This function specifies a Context that can be used to interrupt and cancel the
-// execute calls.
-func (m *Map) BatchContext(x context.Context, queries []string) error {
-	if len(queries) == 0 {
-		return nil
+// Any mappings for statements that have been closed (by a failed 'Close' or
+// 'Clear' call) will be dropped.
+func (m *Map) Shrink() {
+	if m == nil {
+		return
 	}
-	if m.Database == nil {
-		return ErrInvalidDB
+	m.acquire()
+	if m.entries == nil {
+		m.release()
+		return
+	}
+	var n int
+	for _, v := range m.entries {
+		if v != nil {
+			n++
+		}
+	}
+	e := make(map[string]*entry, n)
+	for k, v := range m.entries {
+		if v != nil {
+			e[k] = v
+		}
+	}
+	m.entries = e
+	m.release()
+}
+func (m *Map) closing() bool {
+	return !m.KeepDatabaseOpen && m.closed.CompareAndSwap(false, true)
+}
+func (m *Map) closeDB() error {
+	var err error
+	// Databases that were already closed elsewhere are not treated as an error.
+	if e := m.database().Close(); e != nil && !isClosed(e) {
+		err = &errval{e: e, s: "error closing database"}
+	}
+	if m.ReadDatabase != nil {
+		if e := m.ReadDatabase.Close(); e != nil {
+			err = join(err, &errval{e: e, s: "error closing read database"})
+		}
+	}
+	return err
+}
+func (m *Map) close() error {
+	var r []error
+	for k, v := range m.entries {
+		if v == nil {
+			continue
+		}
+		if err := v.close(); err != nil {
+			r = append(r, &errval{e: err, s: `closing mapping "` + k + `"`})
+			continue
+		}
+		m.entries[k] = nil
+	}
+	if err := m.closeTemplates(); err != nil {
+		r = append(r, err)
+	}
+	return errors.Join(r...)
+}
+func cancelNop() {}
+func join(err, e error) error {
+	if err == nil {
+		return e
+	}
+	if e == nil {
+		return err
+	}
+	return errors.Join(err, e)
+}
+func wait(x context.Context, f func() error) error {
+	if err := x.Err(); err != nil {
+		return err
+	}
+	e := make(chan error, 1)
+	go func() {
+		e <- f()
+	}()
+	select {
+	case err := <-e:
+		return err
+	case <-x.Done():
+		return x.Err()
+	}
+}
+func (m *Map) context(name string) (context.Context, context.CancelFunc) {
+	if m == nil {
+		return context.Background(), cancelNop
+	}
+	d := m.Timeout
+	// The lookup is only done if a statement with a timeout was ever added, so
+	// Maps without any do not take the lock here.
+	if len(name) > 0 && m.timed.Load() {
+		m.lock.RLock()
+		if e := m.entries[name]; e != nil && e.timeout > 0 {
+			d = e.timeout
+		}
+		m.lock.RUnlock()
+	}
+	if d <= 0 {
+		return context.Background(), cancelNop
+	}
+	return context.WithTimeout(context.Background(), d)
+}
+func isStale(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) || err.Error() == "sql: statement is closed"
+}
+func isClosed(err error) bool {
+	return err.Error() == "sql: database is closed"
+}
+func (e *entry) close() error {
+	if e.stmt == nil {
+		return nil
+	}
+	err := e.stmt.Close()
+	if e.read != nil {
+		if v := e.read.Close(); err == nil {
+			err = v
+		}
+	}
+	for i := range e.pool {
+		if v := e.pool[i].Close(); err == nil {
+			err = v
+		}
+	}
+	return err
+}
+func (e *entry) verify(name string, r *sql.Rows) error {
+	c, err := r.Columns()
+	if err != nil {
+		return err
+	}
+	ok := len(c) == len(e.cols)
+	for i := 0; ok && i < len(c); i++ {
+		ok = false
+		for n := range e.cols {
+			if c[i] == e.cols[n] {
+				ok = true
+				break
+			}
+		}
+	}
+	if !ok {
+		return &errval{s: `mapping "` + name + `" columns [` + strings.Join(c, ", ") + `] do not match expected columns [` + strings.Join(e.cols, ", ") + `]`}
+	}
+	e.checked.Store(true)
+	return nil
+}
+func (e *entry) has(s *sql.Stmt) bool {
+	if e.stmt == s || e.read == s {
+		return true
+	}
+	for i := range e.pool {
+		if e.pool[i] == s {
+			return true
+		}
+	}
+	return false
+}
+func (e *entry) release() bool {
+	if e.refs > 0 {
+		e.refs--
+		return false
+	}
+	return true
+}
+func (e *entry) pick(read bool) *sql.Stmt {
+	if read && e.read != nil {
+		return e.read
+	}
+	if len(e.pool) > 0 {
+		if i := int(e.next.Add(1) % uint32(len(e.pool)+1)); i > 0 {
+			return e.pool[i-1]
+		}
+	}
+	return e.stmt
+}
+func (m *Map) prepare(x context.Context, c *sql.Conn, name, query string) (*entry, error) {
+	var (
+		s   *sql.Stmt
+		q   = m.Dialect.rewrite(query)
+		err error
+	)
+	if m.closed.Load() {
+		return nil, ErrClosed
+	}
+	if m.Passthrough {
+		return &entry{conn: c, query: query, text: q, args: count(q), kind: classify(q)}, nil
+	}
+	if c != nil {
+		s, err = c.PrepareContext(x, q)
+	} else {
+		s, err = m.database().PrepareContext(x, q)
+	}
+	if err != nil {
+		if isClosed(err) {
+			err = ErrClosed
+		}
+		m.logf(`error preparing mapping "%s": %s`, name, err)
+		return nil, err
+	}
+	e := &entry{stmt: s, conn: c, query: query, args: count(q), kind: classify(q)}
+	if c != nil || m.ReadDatabase == nil {
+		return e, nil
+	}
+	if e.read, err = m.ReadDatabase.PrepareContext(x, q); err != nil {
+		m.logf(`error preparing mapping "%s" on read database: %s`, name, err)
+		s.Close()
+		return nil, err
+	}
+	return e, nil
+}
+func (m *Map) validate(e *entry, name string, rows bool, args []interface{}) error {
+	if m.Strict {
+		switch {
+		case rows && e.kind == kindExec:
+			return &errval{s: `mapping "` + name + `" does not return rows and cannot be used with Query`}
+		case !rows && e.kind == kindRows:
+			return &errval{s: `mapping "` + name + `" returns rows and cannot be used with Exec`}
+		}
+	}
+	if !m.ValidateArgs || len(args) == e.args {
+		return nil
+	}
+	return &errval{s: `mapping "` + name + `" expects ` + strconv.Itoa(e.args) + " arguments, got " + strconv.Itoa(len(args))}
+}
+func (m *Map) runner(e *entry, read bool) runner {
+	switch {
+	case e.conn != nil:
+		return e.conn
+	case read && m.ReadDatabase != nil:
+		return m.ReadDatabase
+	}
+	return m.database()
+}
+func (m *Map) database() *sql.DB {
+	// A swapped Database is only used while the Database field is unchanged, so
+	// assigning the field after a swap replaces the swapped Database.
+	if s := m.active.Load(); s != nil && s.base == m.Database {
+		return s.db
+	}
+	return m.Database
+}
+func (m *Map) stmt(x context.Context, name string, read bool) (*entry, *sql.Stmt, error) {
+	if o := m.one.Load(); o != nil && o.name == name {
+		// A Map with a single prepared statement can skip the lock entirely.
+		if m.MaxEntries > 0 {
+			o.e.last.Store(m.tick.Add(1))
+		}
+		if read && o.read != nil {
+			return o.e, o.read, nil
+		}
+		return o.e, o.stmt, nil
+	}
+	m.lock.RLock()
+	e, ok := m.entries[name]
+	if !ok || e == nil {
+		if m.lock.RUnlock(); m.closed.Load() {
+			return nil, nil, ErrClosed
+		}
+		return nil, nil, &errval{e: ErrNotFound, s: `mapping "` + name + `"`}
+	}
+	s := e.pick(read)
+	if m.lock.RUnlock(); m.MaxEntries > 0 {
+		e.last.Store(m.tick.Add(1))
+	}
+	if s != nil || !e.lazy {
+		return e, s, nil
+	}
+	s, err := m.load(x, e, name, read)
+	if err != nil {
+		return nil, nil, err
+	}
+	return e, s, nil
+}
+func (m *Map) acquire() {
+	m.lock.Lock()
+	m.one.Store(nil)
+}
+func (m *Map) release() {
+	// The single statement shortcut is only published when there is exactly one
+	// prepared, unpooled statement, as 'pick' does not need to rotate it.
+	var o *single
+	if len(m.entries) == 1 {
+		for k, v := range m.entries {
+			if v != nil && v.stmt != nil && len(v.pool) == 0 {
+				o = &single{e: v, stmt: v.stmt, read: v.read, name: k}
+			}
+		}
+	}
+	m.one.Store(o)
+	m.lock.Unlock()
+}
+func (m *Map) load(x context.Context, e *entry, name string, read bool) (*sql.Stmt, error) {
+	// The entry lock makes sure that concurrent first uses only prepare the
+	// statement once.
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m.lock.RLock()
+	s := e.pick(read)
+	if m.lock.RUnlock(); s != nil {
+		return s, nil
+	}
+	n, err := m.prepare(x, e.conn, name, e.query)
+	if err != nil {
+		return nil, &errval{e: err, s: `error preparing mapping "` + name + `"`}
+	}
+	m.acquire()
+	if v, ok := m.entries[name]; !ok || v != e {
+		m.release()
+		n.close()
+		return nil, &errval{e: ErrNotFound, s: `mapping "` + name + `"`}
+	}
+	e.stmt, e.read, e.text = n.stmt, n.read, n.text
+	s = e.pick(read)
+	m.release()
+	return s, nil
+}
+func (m *Map) pending(c *sql.Conn, query string) (*entry, error) {
+	if m.closed.Load() {
+		return nil, ErrClosed
+	}
+	q := m.Dialect.rewrite(query)
+	return &entry{conn: c, query: query, args: count(q), kind: classify(q), lazy: true}, nil
+}
+func (m *Map) reprepare(x context.Context, name string, old *sql.Stmt, read bool) (*sql.Stmt, error) {
+	m.acquire()
+	e, ok := m.entries[name]
+	if !ok || e == nil {
+		m.release()
+		return nil, &errval{e: ErrNotFound, s: `mapping "` + name + `"`}
+	}
+	if old != nil && !e.has(old) {
+		// Another call already re-prepared this statement.
+		s := e.pick(read)
+		m.release()
+		return s, nil
+	}
+	n, err := m.prepare(x, e.conn, name, e.query)
+	if err == nil && len(e.pool) > 0 {
+		if err = m.fill(x, n, name, len(e.pool)+1); err != nil {
+			n.close()
+		}
+	}
+	if err != nil {
+		m.release()
+		return nil, &errval{e: err, s: `error preparing mapping "` + name + `"`}
+	}
+	e.close()
+	e.stmt, e.read, e.text, e.pool = n.stmt, n.read, n.text, n.pool
+	s := e.pick(read)
+	m.release()
+	return s, nil
+}
+func (e errval) Error() string {
+	if e.e == nil {
+		return e.s
+	}
+	return e.s + ": " + e.e.Error()
+}
+func (e errval) Unwrap() error {
+	return e.e
+}
+
+// Remove will attempt to remove the statement with the provided name.
+//
+// This function will return True if an open statement was found and removed.
+// Otherwise the function will return false. A mapping for a closed statement is
+// also removed, but False is returned.
+//
+// This will also close the removed statement.
+func (m *Map) Remove(name string) bool {
+	if m == nil {
+		return false
+	}
+	m.acquire()
+	s, ok := m.entries[name]
+	if delete(m.entries, name); !ok || s == nil {
+		m.release()
+		return false
+	}
+	c := s.release()
+	// Close the statement after releasing the lock, as a slow close would block
+	// any other operations on the Map.
+	if m.release(); c {
+		s.close()
+	}
+	if m.OnRemove != nil {
+		m.OnRemove(name)
+	}
+	return true
+}
+
+// RemoveAll will attempt to remove the statements with the provided names. Any
+// names that are not mapped are skipped.
+//
+// This function will return the number of open statements that were found and
+// removed. Any mappings for closed statements that match are also removed, but
+// are not counted. The removals are done together, so other calls cannot change
+// the Map between them. This will also close the removed statements.
+func (m *Map) RemoveAll(names ...string) int {
+	if m == nil {
+		return 0
+	}
+	var (
+		r []string
+		c []*entry
+	)
+	m.acquire()
+	for _, k := range names {
+		e, ok := m.entries[k]
+		if !ok {
+			continue
+		}
+		if delete(m.entries, k); e == nil {
+			continue
+		}
+		if e.release() {
+			c = append(c, e)
+		}
+		r = append(r, k)
+	}
+	// Close the statements after releasing the lock, as a slow close would block
+	// any other operations on the Map.
+	m.release()
+	m.removed(c, r)
+	return len(r)
+}
+
+// RemovePrefix will remove all the statements with names that start with the
+// provided prefix.
+//
+// This function will return the number of open statements that were removed.
+// Any mappings for closed statements that match are also removed, but are not
+// counted. This will also close the removed statements.
+func (m *Map) RemovePrefix(prefix string) int {
+	if m == nil {
+		return 0
+	}
+	var (
+		r []string
+		c []*entry
+	)
+	m.acquire()
+	for k, e := range m.entries {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if delete(m.entries, k); e == nil {
+			continue
+		}
+		if e.release() {
+			c = append(c, e)
+		}
+		r = append(r, k)
+	}
+	// Close the statements after releasing the lock, as a slow close would block
+	// any other operations on the Map.
+	m.release()
+	m.removed(c, r)
+	return len(r)
+}
+func (m *Map) removed(c []*entry, r []string) {
+	for i := range c {
+		c[i].close()
+	}
+	if m.OnRemove == nil {
+		return
+	}
+	for i := range r {
+		m.OnRemove(r[i])
+	}
+}
+
+// Rename will move the statement with the provided old name to the new name. The
+// statement will not be prepared again.
+//
+// This function will return an error if the old name does not exist or if the
+// new name is already mapped.
+func (m *Map) Rename(old, name string) error {
+	if m == nil {
+		return ErrInvalidDB
+	}
+	m.acquire()
+	e, ok := m.entries[old]
+	if !ok || e == nil {
+		m.release()
+		return &errval{e: ErrNotFound, s: `mapping "` + old + `"`}
+	}
+	if v, ok := m.entries[name]; ok && v != nil {
+		m.release()
+		return &errval{e: ErrDuplicateName, s: `mapping "` + name + `"`}
+	}
+	delete(m.entries, old)
+	m.entries[name] = e
+	m.release()
+	return nil
+}
+
+// Alias will map the new name to the same statement as the existing name. The
+// statement will not be prepared again and will be shared by both names.
+//
+// This function will return an error if the existing name does not exist or if
+// the new name is already mapped.
+//
+// Shared statements are only closed by 'Remove' (or when evicted) once every
+// name that refers to them has been removed. Execution counters returned by
+// 'Stats' are also shared.
+func (m *Map) Alias(existing, name string) error {
+	if m == nil {
+		return ErrInvalidDB
+	}
+	m.acquire()
+	e, ok := m.entries[existing]
+	if !ok || e == nil {
+		m.release()
+		return &errval{e: ErrNotFound, s: `mapping "` + existing + `"`}
+	}
+	if v, ok := m.entries[name]; ok && v != nil {
+		m.release()
+		return &errval{e: ErrDuplicateName, s: `mapping "` + name + `"`}
+	}
+	e.refs++
+	m.store(name, e)
+	m.release()
+	return nil
+}
+
+// Contains returns True if the name provided has an associated statement.
+func (m *Map) Contains(name string) bool {
+	if m == nil {
+		return false
+	}
+	m.lock.RLock()
+	if len(m.entries) == 0 {
+		m.lock.RUnlock()
+		return false
+	}
+	s, ok := m.entries[name]
+	m.lock.RUnlock()
+	return ok && s != nil
+}
+
+// Add will prepare and add the specified query to the Map with the provided name.
+//
+// This will only add the mapping if the 'Prepare' function is successful. Otherwise
+// the prepare error will be returned.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+func (m *Map) Add(name, query string) error {
+	return m.AddContext(context.Background(), name, query)
+}
+
+// AddAndGet will prepare and add the specified query to the Map with the provided
+// name and will return the prepared statement.
+//
+// If a mapping with the same name already exists, the existing statement will be
+// returned with an error wrapping 'ErrDuplicateName', so it can still be used.
+// Otherwise, any prepare error will be returned. The statement is always
+// prepared, even when the 'Lazy' property is True.
+func (m *Map) AddAndGet(name, query string) (*sql.Stmt, error) {
+	return m.AddAndGetContext(context.Background(), name, query)
+}
+
+// AddConn will prepare the specified query on the supplied connection and add it
+// to the Map with the provided name.
+//
+// The statement will be bound to the connection and can only be used while the
+// connection is open. Closing or removing the statement will not close the
+// connection, which must be closed separately after the statement is no longer
+// needed. If the statement is re-prepared, it will be re-prepared on the same
+// connection.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+func (m *Map) AddConn(c *sql.Conn, name, query string) error {
+	return m.AddConnContext(context.Background(), c, name, query)
+}
+
+// AddPooled will prepare the specified query 'n' times and add it to the Map
+// with the provided name. Executions of the statement will rotate between each
+// of the prepared copies.
+//
+// This can reduce contention on a single heavily used statement, but each copy
+// holds separate prepared statement resources on the Database. Statements that
+// are not contended will not benefit from this. Any value of 'n' less than two
+// is the same as calling 'Add'. Queries using the 'ReadDatabase' are not pooled.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+func (m *Map) AddPooled(name, query string, n int) error {
+	return m.AddPooledContext(context.Background(), name, query, n)
+}
+
+// AddTyped will prepare and add the specified query to the Map with the provided
+// name, along with the column names the query is expected to return.
+//
+// The first time the statement is used with a 'Query' function, the returned
+// columns will be compared against the expected columns (in any order) and an
+// error describing the mismatch will be returned if they differ. This can be
+// used to detect schema changes before they break any scans.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+func (m *Map) AddTyped(name, query string, columns []string) error {
+	return m.AddTypedContext(context.Background(), name, query, columns)
+}
+
+// AddWithTags will prepare and add the specified query to the Map with the
+// provided name, along with a set of tags (labels) for the statement.
+//
+// Tags can be used to group statements in metrics and logs. They are included
+// in the 'Stats' output and can be read in the 'Observer' function using the
+// 'TagsFromContext' function. The tags are copied, so the supplied map can be
+// reused.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+func (m *Map) AddWithTags(name, query string, tags map[string]string) error {
+	return m.AddWithTagsContext(context.Background(), name, query, tags)
+}
+
+// AddWithTimeout will prepare and add the specified query to the Map with the
+// provided name, along with a timeout for the statement.
+//
+// The timeout is used as a deadline for calls to the non-Context execution
+// functions, such as 'Exec', 'Query' and 'QueryRow', with this statement and
+// takes priority over the 'Timeout' property of the Map. A timeout of zero or
+// less will use the Map Timeout instead. The Context variants of the functions
+// will never have this applied, so any deadline set on the supplied Context by
+// the caller takes priority.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+func (m *Map) AddWithTimeout(name, query string, d time.Duration) error {
+	return m.AddWithTimeoutContext(context.Background(), name, query, d)
+}
+
+// AddIfNotExists will prepare and add the specified query to the Map with the
+// provided name, only if a mapping with the same name does not already exist.
+//
+// This function will return True if the mapping was created and False if the
+// mapping already existed. If the prepare fails, False and the prepare error
+// will be returned.
+func (m *Map) AddIfNotExists(name, query string) (bool, error) {
+	return m.AddIfNotExistsContext(context.Background(), name, query)
+}
+
+// AddOrReplace will prepare and add the specified query to the Map with the
+// provided name. If a mapping with the same name already exists, it will be
+// closed and replaced by the new statement.
+//
+// This will only add the mapping if the 'Prepare' function is successful. Otherwise
+// the prepare error will be returned and any existing mapping will be kept.
+func (m *Map) AddOrReplace(name, query string) error {
+	return m.AddOrReplaceContext(context.Background(), name, query)
+}
+
+// MustAdd is similar to 'Add', but will panic with the returned error if the
+// mapping could not be added.
+//
+// This is useful for initialization where any failure would be fatal.
+func (m *Map) MustAdd(name, query string) {
+	if err := m.Add(name, query); err != nil {
+		panic(err)
+	}
+}
+
+// MustExtend is similar to 'Extend', but will panic with the returned error if
+// any of the mappings could not be added.
+//
+// This is useful for initialization where any failure would be fatal.
+func (m *Map) MustExtend(data map[string]string) {
+	if err := m.Extend(data); err != nil {
+		panic(err)
+	}
+}
+
+// AddOrdered will prepare and add all the specified name and query pairs to the
+// Map in the order they are supplied.
+//
+// This will only add each mapping if the 'Prepare' function is successful. This
+// function will stop at and return the first error that occurs, which will include
+// the name of the failing mapping. Any mappings added before the error will be
+// kept.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+func (m *Map) AddOrdered(pairs ...NameQuery) error {
+	return m.AddOrderedContext(context.Background(), pairs...)
+}
+
+// Batch is a function that can be used to perform execute statements in a specific
+// order.
+//
+// This function will execute all the statements in the provided string array and
+// will stop and return any errors that occur.
+//
+// The passed query results will not be returned or parsed.
+func (m *Map) Batch(queries []string) error {
+	return m.BatchContext(context.Background(), queries)
+}
+
+// BatchTimeout is a function that can be used to perform execute statements in a
+// specific order, with a deadline applied to each statement.
+//
+// This function will execute all the statements in the provided string array and
+// will stop and return any errors that occur. Each statement will be given the
+// supplied duration to complete. A duration of zero or less disables the
+// per-statement deadline.
+//
+// The passed query results will not be returned or parsed.
+func (m *Map) BatchTimeout(queries []string, per time.Duration) error {
+	return m.BatchTimeoutContext(context.Background(), queries, per)
+}
+
+// BatchAffected is a function that can be used to perform execute statements in
+// a specific order and return the total number of rows affected.
+//
+// This function will execute all the statements in the provided string array and
+// will stop and return any errors that occur. The returned total will include the
+// rows affected by the statements that completed before the error.
+//
+// Statements such as DDL may report driver-dependent values (often zero) for the
+// number of rows affected.
+func (m *Map) BatchAffected(queries []string) (int64, error) {
+	return m.BatchAffectedContext(context.Background(), queries)
+}
+
+// BatchResults is a function that can be used to perform execute statements in a
+// specific order.
+//
+// This function will execute all the statements in the provided string array and
+// will stop and return any errors that occur.
+//
+// The results of each statement will be returned in the same order as the queries.
+// If an error occurs, the results of the statements that completed before the
+// error will be returned with the error.
+func (m *Map) BatchResults(queries []string) ([]sql.Result, error) {
+	return m.BatchResultsContext(context.Background(), queries)
+}
+
+// BatchTx is a function that can be used to perform execute statements in a
+// specific order inside a single transaction.
+//
+// This function will execute all the statements in the provided string array and
+// will stop and return any errors that occur. If any statement fails, the
+// transaction will be rolled back and none of the statements will take effect.
+//
+// The passed query results will not be returned or parsed.
+func (m *Map) BatchTx(queries []string) error {
+	return m.BatchTxContext(context.Background(), queries)
+}
+
+// Get will attempt to return the statement that is associated with the provided
+// name.
+//
+// This function will return the statement and True if the mapping exists. Otherwise,
+// the statement will be nil and the boolean will be False.
+func (m *Map) Get(name string) (*sql.Stmt, bool) {
+	if m == nil {
+		return nil, false
+	}
+	m.lock.RLock()
+	if len(m.entries) == 0 {
+		m.lock.RUnlock()
+		return nil, false
+	}
+	e, ok := m.entries[name]
+	if !ok || e == nil {
+		m.lock.RUnlock()
+		return nil, ok
+	}
+	s := e.stmt
+	m.lock.RUnlock()
+	return s, true
+}
+
+// Source will attempt to return the query text of the statement that is associated
+// with the provided name.
+//
+// This function will return the query and True if the mapping exists. Otherwise,
+// the query will be empty and the boolean will be False.
+func (m *Map) Source(name string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	m.lock.RLock()
+	e, ok := m.entries[name]
+	if m.lock.RUnlock(); !ok || e == nil {
+		return "", false
+	}
+	return e.query, true
+}
+
+// Entry will attempt to return the statement and the query text that are associated
+// with the provided name. Both values are read together, so they will always
+// match each other.
+//
+// This function will return the statement, query and True if the mapping exists.
+// Otherwise, the statement will be nil, the query will be empty and the boolean
+// will be False.
+func (m *Map) Entry(name string) (*sql.Stmt, string, bool) {
+	if m == nil {
+		return nil, "", false
+	}
+	m.lock.RLock()
+	e, ok := m.entries[name]
+	if !ok || e == nil {
+		m.lock.RUnlock()
+		return nil, "", false
+	}
+	s, q := e.stmt, e.query
+	m.lock.RUnlock()
+	return s, q, true
+}
+
+// GetOrAdd will attempt to return the statement that is associated with the
+// provided name. If the name is not mapped, the query will be prepared, added
+// to the Map and the new statement will be returned.
+//
+// This function will not return an error if a mapping with the provided name
+// already exists. Otherwise, any prepare error will be returned.
+func (m *Map) GetOrAdd(name, query string) (*sql.Stmt, error) {
+	return m.GetOrAddContext(context.Background(), name, query)
+}
+
+// Reprepare will prepare the original query of the statement with the provided
+// name again and replace the current statement with the new one. The old statement
+// will be closed.
+//
+// This is useful when the database connection has been reset and the existing
+// statements are no longer valid. If the prepare fails, the current statement
+// will be left in place and the error will be returned.
+func (m *Map) Reprepare(name string) error {
+	return m.ReprepareContext(context.Background(), name)
+}
+
+// Extend will prepare and add all the specified queries in the provided map to
+// the Map.
+//
+// This will only add each mapping if the 'Prepare' function is successful. Otherwise
+// the prepare error will be returned.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+func (m *Map) Extend(data map[string]string) error {
+	return m.ExtendContext(context.Background(), data)
+}
+
+// ExtendParallel will prepare and add all the specified queries in the provided
+// map to the Map, using up to the specified number of workers to prepare the
+// queries concurrently. A worker count less than one will use a single worker.
+//
+// This is useful for adding a large number of queries to a high latency
+// database. Like 'Extend', each mapping is only added if the 'Prepare' function
+// is successful. Once any mapping fails, the remaining prepare calls will be
+// cancelled and the first error will be returned. Any mappings that were already
+// added will be left in place.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+func (m *Map) ExtendParallel(data map[string]string, workers int) error {
+	return m.ExtendParallelContext(context.Background(), data, workers)
+}
+
+// Validate will prepare all the specified queries in the provided map and will
+// immediately close them without adding them to the Map.
+//
+// This can be used to check that a set of queries is valid before adding them.
+// All the prepare errors that occur will be returned joined together.
+func (m *Map) Validate(data map[string]string) error {
+	return m.ValidateContext(context.Background(), data)
+}
+
+// ValidateContext will prepare all the specified queries in the provided map and
+// will immediately close them without adding them to the Map.
+//
+// This can be used to check that a set of queries is valid before adding them.
+// All the prepare errors that occur will be returned joined together.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) ValidateContext(x context.Context, data map[string]string) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	var r []error
+	for k, v := range data {
+		if err := x.Err(); err != nil {
+			return errors.Join(append(r, err)...)
+		}
+		s, err := m.database().PrepareContext(x, m.Dialect.rewrite(v))
+		if err != nil {
+			r = append(r, &errval{e: err, s: `error preparing mapping "` + k + `"`})
+			continue
+		}
+		s.Close()
+	}
+	return errors.Join(r...)
+}
+
+// ExtendAtomic will prepare and add all the specified queries in the provided map
+// to the Map.
+//
+// This function differs from 'Extend' as if any of the mappings fail to be added,
+// all the mappings added by this call will be closed and removed, leaving the Map
+// as it was before the call. If 'MaxEntries' is set, any statements are only
+// evicted once all the mappings have been added.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+func (m *Map) ExtendAtomic(data map[string]string) error {
+	return m.ExtendAtomicContext(context.Background(), data)
+}
+
+// ExtendCount will prepare and add all the specified queries in the provided map
+// to the Map and will return the number of mappings added.
+//
+// This will only add each mapping if the 'Prepare' function is successful. Otherwise
+// the prepare error will be returned along with the number of mappings that were
+// added before the error.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+func (m *Map) ExtendCount(data map[string]string) (int, error) {
+	return m.ExtendCountContext(context.Background(), data)
+}
+
+// ExtendMissing will prepare and add all the specified queries in the provided
+// map to the Map, skipping any names that are already mapped.
+//
+// This will only add each mapping if the 'Prepare' function is successful. Otherwise
+// the prepare error will be returned. Existing mappings are not prepared again
+// or changed, which allows this to be called repeatedly with the same queries.
+func (m *Map) ExtendMissing(data map[string]string) error {
+	return m.ExtendMissingContext(context.Background(), data)
+}
+
+// AddContext will prepare and add the specified query to the Map with the provided
+// name.
+//
+// This will only add the mapping if the 'Prepare' function is successful. Otherwise
+// the prepare error will be returned.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) AddContext(x context.Context, name, query string) error {
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	select {
+	case <-x.Done():
+		return x.Err()
+	default:
+	}
+	m.acquire()
+	if m.entries == nil {
+		m.entries = make(map[string]*entry, 1)
+	}
+	err := m.add(x, nil, name, query, nil)
+	m.release()
+	return err
+}
+
+// AddAndGetContext will prepare and add the specified query to the Map with the
+// provided name and will return the prepared statement.
+//
+// If a mapping with the same name already exists, the existing statement will be
+// returned with an error wrapping 'ErrDuplicateName', so it can still be used.
+// Otherwise, any prepare error will be returned. The statement is always
+// prepared, even when the 'Lazy' property is True.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare call.
+func (m *Map) AddAndGetContext(x context.Context, name, query string) (*sql.Stmt, error) {
+	if m == nil || m.database() == nil {
+		return nil, ErrInvalidDB
+	}
+	m.acquire()
+	if m.entries == nil {
+		m.entries = make(map[string]*entry, 1)
+	}
+	if e, ok := m.entries[name]; ok && e != nil {
+		s := e.stmt
+		m.release()
+		return s, &errval{e: ErrDuplicateName, s: `mapping "` + name + `"`}
+	}
+	e, err := m.prepare(x, nil, name, query)
+	if err != nil {
+		m.release()
+		return nil, &errval{e: err, s: `error adding mapping "` + name + `"`}
+	}
+	m.store(name, e)
+	s := e.stmt
+	m.release()
+	return s, nil
+}
+
+// AddTypedContext will prepare and add the specified query to the Map with the
+// provided name, along with the column names the query is expected to return.
+//
+// The first time the statement is used with a 'Query' function, the returned
+// columns will be compared against the expected columns (in any order) and an
+// error describing the mismatch will be returned if they differ. This can be
+// used to detect schema changes before they break any scans.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) AddTypedContext(x context.Context, name, query string, columns []string) error {
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	m.acquire()
+	if m.entries == nil {
+		m.entries = make(map[string]*entry, 1)
+	}
+	err := m.add(x, nil, name, query, nil)
+	if err == nil {
+		m.entries[name].cols = append(make([]string, 0, len(columns)), columns...)
+	}
+	m.release()
+	return err
+}
+
+// AddWithTagsContext will prepare and add the specified query to the Map with
+// the provided name, along with a set of tags (labels) for the statement.
+//
+// Tags can be used to group statements in metrics and logs. They are included
+// in the 'Stats' output and can be read in the 'Observer' function using the
+// 'TagsFromContext' function. The tags are copied, so the supplied map can be
+// reused.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare call.
+func (m *Map) AddWithTagsContext(x context.Context, name, query string, tags map[string]string) error {
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	m.acquire()
+	if m.entries == nil {
+		m.entries = make(map[string]*entry, 1)
+	}
+	err := m.add(x, nil, name, query, nil)
+	if err == nil && len(tags) > 0 {
+		t := make(map[string]string, len(tags))
+		for k, v := range tags {
+			t[k] = v
+		}
+		m.entries[name].tags = t
+	}
+	m.release()
+	return err
+}
+
+// AddWithTimeoutContext will prepare and add the specified query to the Map
+// with the provided name, along with a timeout for the statement.
+//
+// The timeout is used as a deadline for calls to the non-Context execution
+// functions, such as 'Exec', 'Query' and 'QueryRow', with this statement and
+// takes priority over the 'Timeout' property of the Map. A timeout of zero or
+// less will use the Map Timeout instead. The Context variants of the functions
+// will never have this applied, so any deadline set on the supplied Context by
+// the caller takes priority.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare call.
+func (m *Map) AddWithTimeoutContext(x context.Context, name, query string, d time.Duration) error {
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	m.acquire()
+	if m.entries == nil {
+		m.entries = make(map[string]*entry, 1)
+	}
+	err := m.add(x, nil, name, query, nil)
+	if err == nil && d > 0 {
+		m.entries[name].timeout = d
+		m.timed.Store(true)
+	}
+	m.release()
+	return err
+}
+
+// AddConnContext will prepare the specified query on the supplied connection and
+// add it to the Map with the provided name.
+//
+// The statement will be bound to the connection and can only be used while the
+// connection is open. Closing or removing the statement will not close the
+// connection, which must be closed separately after the statement is no longer
+// needed. If the statement is re-prepared, it will be re-prepared on the same
+// connection.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare call.
+func (m *Map) AddConnContext(x context.Context, c *sql.Conn, name, query string) error {
+	if m == nil {
+		return ErrInvalidDB
+	}
+	if c == nil {
+		return &errval{s: "connection cannot be nil"}
+	}
+	m.acquire()
+	if m.entries == nil {
+		m.entries = make(map[string]*entry, 1)
+	}
+	err := m.add(x, c, name, query, nil)
+	m.release()
+	return err
+}
+func (m *Map) fill(x context.Context, e *entry, name string, n int) error {
+	if e.stmt == nil || n <= 1 {
+		return nil
+	}
+	q := m.Dialect.rewrite(e.query)
+	e.pool = make([]*sql.Stmt, 0, n-1)
+	for i := 1; i < n; i++ {
+		s, err := m.database().PrepareContext(x, q)
+		if err != nil {
+			m.logf(`error preparing mapping "%s": %s`, name, err)
+			return err
+		}
+		e.pool = append(e.pool, s)
+	}
+	return nil
+}
+
+// AddPooledContext will prepare the specified query 'n' times and add it to the
+// Map with the provided name. Executions of the statement will rotate between
+// each of the prepared copies.
+//
+// This can reduce contention on a single heavily used statement, but each copy
+// holds separate prepared statement resources on the Database. Statements that
+// are not contended will not benefit from this. Any value of 'n' less than two
+// is the same as calling 'Add'. Queries using the 'ReadDatabase' are not pooled.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) AddPooledContext(x context.Context, name, query string, n int) error {
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	m.acquire()
+	if m.entries == nil {
+		m.entries = make(map[string]*entry, 1)
+	}
+	if e, ok := m.entries[name]; ok && e != nil {
+		m.release()
+		return &errval{e: ErrDuplicateName, s: `mapping "` + name + `"`}
+	}
+	e, err := m.prepare(x, nil, name, query)
+	if err == nil {
+		if err = m.fill(x, e, name, n); err != nil {
+			e.close()
+		}
+	}
+	if err != nil {
+		m.release()
+		return &errval{e: err, s: `error adding mapping "` + name + `"`}
+	}
+	m.store(name, e)
+	m.release()
+	return nil
+}
+func (m *Map) add(x context.Context, c *sql.Conn, name, query string, p []string) error {
+	e, err := m.create(x, c, name, query, p)
+	if err != nil {
+		return err
+	}
+	m.store(name, e)
+	return nil
+}
+func (m *Map) create(x context.Context, c *sql.Conn, name, query string, p []string) (*entry, error) {
+	if e, ok := m.entries[name]; ok && e != nil {
+		return nil, &errval{e: ErrDuplicateName, s: `mapping "` + name + `"`}
+	}
+	e, err := m.build(x, c, name, query)
+	if err != nil {
+		return nil, &errval{e: err, s: `error adding mapping "` + name + `"`}
+	}
+	e.params = p
+	return e, nil
+}
+func (m *Map) build(x context.Context, c *sql.Conn, name, query string) (*entry, error) {
+	if m.Lazy && !m.Passthrough {
+		return m.pending(c, query)
+	}
+	return m.prepare(x, c, name, query)
+}
+func (m *Map) evict(keep string) {
+	var (
+		n string
+		v int64
+	)
+	for k, e := range m.entries {
+		if k == keep {
+			continue
+		}
+		if e == nil {
+			// Closed entries can be dropped without evicting a live statement.
+			delete(m.entries, k)
+			return
+		}
+		if l := e.last.Load(); len(n) == 0 || l < v {
+			n, v = k, l
+		}
+	}
+	if len(n) == 0 {
+		return
+	}
+	if e := m.entries[n]; e.release() {
+		e.close()
+	}
+	if delete(m.entries, n); m.OnRemove != nil {
+		// The lock is held here, so the callback is called separately to prevent
+		// a deadlock if it uses the Map.
+		go m.OnRemove(n)
+	}
+}
+func (m *Map) store(name string, e *entry) {
+	m.entries[name] = e
+	if m.MaxEntries <= 0 {
+		return
+	}
+	e.last.Store(m.tick.Add(1))
+	m.trim(name)
+}
+func (m *Map) trim(keep string) {
+	for m.MaxEntries > 0 && len(m.entries) > m.MaxEntries {
+		m.evict(keep)
+	}
+}
+
+// AddIfNotExistsContext will prepare and add the specified query to the Map with
+// the provided name, only if a mapping with the same name does not already exist.
+//
+// This function will return True if the mapping was created and False if the
+// mapping already existed. If the prepare fails, False and the prepare error
+// will be returned.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare call.
+func (m *Map) AddIfNotExistsContext(x context.Context, name, query string) (bool, error) {
+	if m == nil || m.database() == nil {
+		return false, ErrInvalidDB
+	}
+	m.acquire()
+	if m.entries == nil {
+		m.entries = make(map[string]*entry, 1)
+	}
+	if e, ok := m.entries[name]; ok && e != nil {
+		m.release()
+		return false, nil
+	}
+	err := m.add(x, nil, name, query, nil)
+	m.release()
+	return err == nil, err
+}
+
+// AddOrReplaceContext will prepare and add the specified query to the Map with
+// the provided name. If a mapping with the same name already exists, it will be
+// closed and replaced by the new statement.
+//
+// This will only add the mapping if the 'Prepare' function is successful. Otherwise
+// the prepare error will be returned and any existing mapping will be kept.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare call.
+func (m *Map) AddOrReplaceContext(x context.Context, name, query string) error {
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	n, err := m.prepare(x, nil, name, query)
+	if err != nil {
+		return &errval{e: err, s: `error adding mapping "` + name + `"`}
+	}
+	m.acquire()
+	if m.entries == nil {
+		m.entries = make(map[string]*entry, 1)
+	}
+	if e, ok := m.entries[name]; ok && e != nil && e.release() {
+		e.close()
+	}
+	m.store(name, n)
+	m.release()
+	return nil
+}
+
+// GetOrAddContext will attempt to return the statement that is associated with
+// the provided name. If the name is not mapped, the query will be prepared, added
+// to the Map and the new statement will be returned.
+//
+// This function will not return an error if a mapping with the provided name
+// already exists. Otherwise, any prepare error will be returned. The prepare
+// call is made while holding the lock, so concurrent calls with the same name
+// will only prepare the query once.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare call.
+func (m *Map) GetOrAddContext(x context.Context, name, query string) (*sql.Stmt, error) {
+	if m == nil || m.database() == nil {
+		return nil, ErrInvalidDB
+	}
+	m.acquire()
+	if m.entries == nil {
+		m.entries = make(map[string]*entry, 1)
+	}
+	if e, ok := m.entries[name]; ok && e != nil {
+		s := e.stmt
+		m.release()
+		return s, nil
+	}
+	e, err := m.prepare(x, nil, name, query)
+	if err != nil {
+		m.release()
+		return nil, &errval{e: err, s: `error adding mapping "` + name + `"`}
+	}
+	m.store(name, e)
+	s := e.stmt
+	m.release()
+	return s, nil
+}
+
+// ReprepareContext will prepare the original query of the statement with the
+// provided name again and replace the current statement with the new one. The
+// old statement will be closed.
+//
+// This is useful when the database connection has been reset and the existing
+// statements are no longer valid. If the prepare fails, the current statement
+// will be left in place and the error will be returned.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare call.
+func (m *Map) ReprepareContext(x context.Context, name string) error {
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	_, err := m.reprepare(x, name, nil, false)
+	return err
+}
+
+// BatchContext is a function that can be used to perform execute statements in a
+// specific order. This function will execute all the statements in the provided
+// string array and will stop and return any errors that occur.
+//
+// The passed query results will not be returned or parsed.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// execute calls.
+func (m *Map) BatchContext(x context.Context, queries []string) error {
+	_, err := m.batch(x, queries, false, 0)
+	return err
+}
+
+// BatchTimeoutContext is a function that can be used to perform execute statements
+// in a specific order, with a deadline applied to each statement.
+//
+// This function will execute all the statements in the provided string array and
+// will stop and return any errors that occur. Each statement will be given the
+// supplied duration to complete, in addition to any deadline of the supplied
+// Context. A duration of zero or less disables the per-statement deadline.
+//
+// The passed query results will not be returned or parsed.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// execute calls.
+func (m *Map) BatchTimeoutContext(x context.Context, queries []string, per time.Duration) error {
+	_, err := m.batch(x, queries, false, per)
+	return err
+}
+
+// BatchResultsContext is a function that can be used to perform execute statements
+// in a specific order. This function will execute all the statements in the provided
+// string array and will stop and return any errors that occur.
+//
+// The results of each statement will be returned in the same order as the queries.
+// If an error occurs, the results of the statements that completed before the
+// error will be returned with the error.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// execute calls.
+func (m *Map) BatchResultsContext(x context.Context, queries []string) ([]sql.Result, error) {
+	return m.batch(x, queries, true, 0)
+}
+
+// BatchAffectedContext is a function that can be used to perform execute statements
+// in a specific order and return the total number of rows affected. This function
+// will execute all the statements in the provided string array and will stop and
+// return any errors that occur.
+//
+// The returned total will include the rows affected by the statements that
+// completed before the error. Statements such as DDL may report driver-dependent
+// values (often zero) for the number of rows affected.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// execute calls.
+func (m *Map) BatchAffectedContext(x context.Context, queries []string) (int64, error) {
+	r, err := m.batch(x, queries, true, 0)
+	var n int64
+	for i := range r {
+		c, e := r[i].RowsAffected()
+		if e != nil {
+			return n, join(err, &errval{e: e, s: `error reading rows affected of statement mapping "` + queries[i] + `"`})
+		}
+		n += c
+	}
+	return n, err
+}
+
+// BatchTxContext is a function that can be used to perform execute statements in
+// a specific order inside a single transaction. This function will execute all the
+// statements in the provided string array and will stop and return any errors that
+// occur.
+//
+// If any statement fails, the transaction will be rolled back and none of the
+// statements will take effect. Otherwise, the transaction will be committed.
+//
+// The passed query results will not be returned or parsed.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// execute calls.
+func (m *Map) BatchTxContext(x context.Context, queries []string) error {
+	if len(queries) == 0 {
+		return nil
+	}
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	m.acquire()
+	t, err := m.database().BeginTx(x, nil)
+	if err != nil {
+		m.release()
+		return &errval{e: err, s: "error starting transaction"}
+	}
+	for i := range queries {
+		if _, err = t.ExecContext(x, queries[i]); err != nil {
+			err = &errval{e: err, s: `error executing statement mapping "` + queries[i] + `"`}
+			break
+		}
+	}
+	if err != nil {
+		t.Rollback()
+	} else if err = t.Commit(); err != nil {
+		err = &errval{e: err, s: "error committing transaction"}
+	}
+	m.release()
+	return err
+}
+func (m *Map) batch(x context.Context, queries []string, keep bool, per time.Duration) ([]sql.Result, error) {
+	if len(queries) == 0 {
+		return nil, nil
+	}
+	if m == nil || m.database() == nil {
+		return nil, ErrInvalidDB
+	}
+	var (
+		o   []sql.Result
+		r   sql.Result
+		err error
+	)
+	if keep {
+		o = make([]sql.Result, 0, len(queries))
 	}
-	var err error
-	m.lock.Lock()
+	m.acquire()
 	for i := range queries {
 		select {
 		case <-x.Done():
@@ -232,13 +2332,23 @@ func (m *Map) BatchContext(x context.Context, queries []string) error {
 		if err != nil {
 			break
 		}
-		if _, err = m.Database.ExecContext(x, queries[i]); err != nil {
+		if per > 0 {
+			v, f := context.WithTimeout(x, per)
+			r, err = m.database().ExecContext(v, queries[i])
+			f()
+		} else {
+			r, err = m.database().ExecContext(x, queries[i])
+		}
+		if err != nil {
 			err = &errval{e: err, s: `error executing statement mapping "` + queries[i] + `"`}
 			break
 		}
+		if keep {
+			o = append(o, r)
+		}
 	}
-	m.lock.Unlock()
-	return err
+	m.release()
+	return o, err
 }
 
 // Exec will attempt to get the statement with the provided name and then attempt
@@ -246,7 +2356,27 @@ func (m *Map) BatchContext(x context.Context, queries []string) error {
 //
 // This provides the results of the Exec function.
 func (m *Map) Exec(name string, args ...interface{}) (sql.Result, error) {
-	return m.ExecContext(context.Background(), name, args...)
+	x, f := m.context(name)
+	r, err := m.ExecContext(x, name, args...)
+	f()
+	return r, err
+}
+
+// ExecMany will attempt to get the statement with the provided name and then
+// call the 'Exec' function on the statement once for each of the supplied
+// argument sets, in order.
+//
+// The statement is only looked up once, but argument validation, middleware,
+// retries and hooks are applied to each argument set.
+//
+// This function will return the total number of rows affected and will stop and
+// return the first error that occurs, which will include the index of the failing
+// argument set. The returned count includes the rows affected before the error.
+func (m *Map) ExecMany(name string, args [][]interface{}) (int64, error) {
+	x, f := m.context(name)
+	n, err := m.ExecManyContext(x, name, args)
+	f()
+	return n, err
 }
 
 // Query will attempt to get the statement with the provided name and then attempt
@@ -254,7 +2384,10 @@ func (m *Map) Exec(name string, args ...interface{}) (sql.Result, error) {
 //
 // This provides the results of the Query function.
 func (m *Map) Query(name string, args ...interface{}) (*sql.Rows, error) {
-	return m.QueryContext(context.Background(), name, args...)
+	// The cancel function is not called here as it would close the returned
+	// Rows. The Context will be released once the Timeout expires instead.
+	x, _ := m.context(name)
+	return m.QueryContext(x, name, args...)
 }
 
 // QueryRow will attempt to get the statement with the provided name and then attempt
@@ -265,7 +2398,100 @@ func (m *Map) Query(name string, args ...interface{}) (*sql.Rows, error) {
 //
 // If the returned boolean is True, the result is not-nil and safe to use.
 func (m *Map) QueryRow(name string, args ...interface{}) (*sql.Row, bool) {
-	return m.QueryRowContext(context.Background(), name, args...)
+	x, _ := m.context(name)
+	return m.QueryRowContext(x, name, args...)
+}
+
+// QueryRowErr will attempt to get the statement with the provided name and then
+// attempt to call the 'QueryRow' function on the statement.
+//
+// This function differs from 'QueryRow' as this will return an error instead of
+// a boolean, allowing for a nil Database to be distinguished from a missing
+// statement.
+//
+// If the returned error is nil, the result is not-nil and safe to use.
+func (m *Map) QueryRowErr(name string, args ...interface{}) (*sql.Row, error) {
+	x, _ := m.context(name)
+	return m.QueryRowErrContext(x, name, args...)
+}
+
+// QueryRowScan will attempt to get the statement with the provided name, call
+// the 'QueryRow' function on the statement and then scan the result into the
+// supplied destination values.
+//
+// This will return an error if the statement does not exist. If no rows were
+// returned, 'sql.ErrNoRows' will be returned unchanged.
+func (m *Map) QueryRowScan(name string, dest []interface{}, args ...interface{}) error {
+	x, f := m.context(name)
+	err := m.QueryRowScanContext(x, name, dest, args...)
+	f()
+	return err
+}
+
+// QueryRowExists will attempt to get the statement with the provided name, call
+// the 'Query' function on the statement and return True if at least one row was
+// returned.
+//
+// This will return an error if the statement does not exist or the query fails.
+// Unlike 'QueryRow', no rows being returned is not an error and will instead
+// return False.
+func (m *Map) QueryRowExists(name string, args ...interface{}) (bool, error) {
+	x, f := m.context(name)
+	r, err := m.QueryRowExistsContext(x, name, args...)
+	f()
+	return r, err
+}
+
+// ExecInsert will attempt to get the statement with the provided name, call the
+// 'Exec' function on the statement and return the 'LastInsertId' of the result.
+//
+// Not all drivers support 'LastInsertId' (such as Postgres), for those drivers
+// 'QueryInsert' can be used with a 'RETURNING' clause instead.
+func (m *Map) ExecInsert(name string, args ...interface{}) (int64, error) {
+	x, f := m.context(name)
+	r, err := m.ExecInsertContext(x, name, args...)
+	f()
+	return r, err
+}
+
+// QueryInsert will attempt to get the statement with the provided name, call the
+// 'QueryRow' function on the statement and return the single returned column as
+// an int64.
+//
+// This is intended for statements using a 'RETURNING' clause to return a newly
+// inserted ID. If no rows were returned, 'sql.ErrNoRows' will be returned.
+func (m *Map) QueryInsert(name string, args ...interface{}) (int64, error) {
+	x, f := m.context(name)
+	r, err := m.QueryInsertContext(x, name, args...)
+	f()
+	return r, err
+}
+
+// QueryInt will attempt to get the statement with the provided name, call the
+// 'QueryRow' function on the statement and return the single returned column as
+// an int64. This is intended for statements such as 'SELECT COUNT(*)'.
+//
+// If no rows were returned or the value is NULL, zero and a nil error will be
+// returned. Use 'QueryInsert' if a missing row should return 'sql.ErrNoRows'.
+func (m *Map) QueryInt(name string, args ...interface{}) (int64, error) {
+	x, f := m.context(name)
+	r, err := m.QueryIntContext(x, name, args...)
+	f()
+	return r, err
+}
+
+// QueryFunc will attempt to get the statement with the provided name, call the
+// 'Query' function on the statement and then call the supplied function with
+// the returned Rows.
+//
+// The Rows are always closed once the function returns, even if the function
+// returns an error or panics. Any error returned by the function will be
+// returned, otherwise any error from reading or closing the Rows is returned.
+func (m *Map) QueryFunc(name string, f func(*sql.Rows) error, args ...interface{}) error {
+	x, c := m.context(name)
+	err := m.QueryFuncContext(x, name, f, args...)
+	c()
+	return err
 }
 
 // ExtendContext will prepare and add all the specified queries in the provided
@@ -275,26 +2501,153 @@ func (m *Map) QueryRow(name string, args ...interface{}) (*sql.Row, bool) {
 // the prepare error will be returned.
 //
 // This function does not allow for adding a mapping when one already exists. If
-// a mapping with an overlapping name is attempted, an error will be returned before
-// attempting to prepare the query.
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
 //
 // This function specifies a Context that can be used to interrupt and cancel the
 // prepare calls.
 func (m *Map) ExtendContext(x context.Context, data map[string]string) error {
+	_, err := m.ExtendCountContext(x, data)
+	return err
+}
+
+// ExtendParallelContext will prepare and add all the specified queries in the
+// provided map to the Map, using up to the specified number of workers to
+// prepare the queries concurrently. A worker count less than one will use a
+// single worker.
+//
+// This is useful for adding a large number of queries to a high latency
+// database. Like 'Extend', each mapping is only added if the 'Prepare' function
+// is successful. Once any mapping fails, the remaining prepare calls will be
+// cancelled and the first error will be returned. Any mappings that were already
+// added will be left in place.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) ExtendParallelContext(x context.Context, data map[string]string, workers int) error {
 	if data == nil {
 		return nil
 	}
-	if m.Database == nil {
+	if m == nil || m.database() == nil {
 		return ErrInvalidDB
 	}
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(data) {
+		workers = len(data)
+	}
+	var (
+		w    sync.WaitGroup
+		o    sync.Once
+		c    = make(chan string)
+		b    bool
+		err  error
+		y, f = context.WithCancel(x)
+	)
+	for i := 0; i < workers; i++ {
+		w.Add(1)
+		go func() {
+			defer w.Done()
+			for k := range c {
+				if e := m.addParallel(y, k, data[k]); e != nil {
+					o.Do(func() { err = e })
+					f()
+				}
+			}
+		}()
+	}
+	for k := range data {
+		if b = y.Err() != nil; b {
+			break
+		}
+		c <- k
+	}
+	close(c)
+	w.Wait()
+	// If no worker failed, the loop can only stop early due to the parent Context.
+	if f(); err == nil && b {
+		err = x.Err()
+	}
+	return err
+}
+func (m *Map) addParallel(x context.Context, name, query string) error {
+	m.lock.RLock()
+	e, ok := m.entries[name]
+	if m.lock.RUnlock(); ok && e != nil {
+		return &errval{e: ErrDuplicateName, s: `mapping "` + name + `"`}
+	}
+	if err := x.Err(); err != nil {
+		return err
+	}
+	e, err := m.build(x, nil, name, query)
+	if err != nil {
+		return &errval{e: err, s: `error adding mapping "` + name + `"`}
+	}
+	m.acquire()
 	if m.entries == nil {
-		m.entries = make(map[string]*sql.Stmt, len(data))
+		m.entries = make(map[string]*entry, 1)
+	}
+	// Another call may have added the same name while this was being prepared.
+	if v, ok := m.entries[name]; ok && v != nil {
+		m.release()
+		e.close()
+		return &errval{e: ErrDuplicateName, s: `mapping "` + name + `"`}
+	}
+	m.store(name, e)
+	m.release()
+	return nil
+}
+
+// ExtendCountContext will prepare and add all the specified queries in the
+// provided map to the Map and will return the number of mappings added.
+//
+// This will only add each mapping if the 'Prepare' function is successful. Otherwise
+// the prepare error will be returned along with the number of mappings that were
+// added before the error.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) ExtendCountContext(x context.Context, data map[string]string) (int, error) {
+	return m.extend(x, data, false)
+}
+
+// ExtendMissingContext will prepare and add all the specified queries in the
+// provided map to the Map, skipping any names that are already mapped.
+//
+// This will only add each mapping if the 'Prepare' function is successful. Otherwise
+// the prepare error will be returned. Existing mappings are not prepared again
+// or changed, which allows this to be called repeatedly with the same queries.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) ExtendMissingContext(x context.Context, data map[string]string) error {
+	_, err := m.extend(x, data, true)
+	return err
+}
+func (m *Map) extend(x context.Context, data map[string]string, skip bool) (int, error) {
+	if data == nil {
+		return 0, nil
+	}
+	if m == nil || m.database() == nil {
+		return 0, ErrInvalidDB
 	}
 	var (
-		s   *sql.Stmt
+		n   int
 		err error
 	)
-	m.lock.Lock()
+	m.acquire()
+	if m.entries == nil {
+		m.entries = make(map[string]*entry, len(data))
+	}
 	for k, v := range data {
 		select {
 		case <-x.Done():
@@ -304,62 +2657,156 @@ func (m *Map) ExtendContext(x context.Context, data map[string]string) error {
 		if err != nil {
 			break
 		}
-		if v, ok := m.entries[k]; ok && v != nil {
-			err = &errval{s: `statement with name "` + k + `" already exists`}
+		if e, ok := m.entries[k]; skip && ok && e != nil {
+			continue
+		}
+		if err = m.add(x, nil, k, v, nil); err != nil {
+			break
+		}
+		n++
+	}
+	m.release()
+	return n, err
+}
+
+// ExtendAtomicContext will prepare and add all the specified queries in the
+// provided map to the Map.
+//
+// This function differs from 'ExtendContext' as if any of the mappings fail to
+// be added, all the mappings added by this call will be closed and removed,
+// leaving the Map as it was before the call. If 'MaxEntries' is set, any
+// statements are only evicted once all the mappings have been added.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) ExtendAtomicContext(x context.Context, data map[string]string) error {
+	if data == nil {
+		return nil
+	}
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	var (
+		a   = make([]string, 0, len(data))
+		err error
+	)
+	m.acquire()
+	if m.entries == nil {
+		m.entries = make(map[string]*entry, len(data))
+	}
+	for k, v := range data {
+		if err = x.Err(); err != nil {
 			break
 		}
-		if s, err = m.Database.PrepareContext(x, v); err != nil {
-			err = &errval{e: err, s: `error adding mapping "` + k + `"`}
+		var e *entry
+		if e, err = m.create(x, nil, k, v, nil); err != nil {
 			break
 		}
-		m.entries[k] = s
+		// Entries are not stored using 'store' so nothing is evicted until all
+		// the mappings are added, otherwise a rollback could not restore them.
+		m.entries[k], a = e, append(a, k)
+		e.last.Store(m.tick.Add(1))
 	}
-	m.lock.Unlock()
+	if err != nil {
+		for i := range a {
+			if e := m.entries[a[i]]; e != nil {
+				e.close()
+			}
+			delete(m.entries, a[i])
+		}
+	} else {
+		m.trim("")
+	}
+	m.release()
+	return err
+}
+
+// AddOrderedContext will prepare and add all the specified name and query pairs
+// to the Map in the order they are supplied.
+//
+// This will only add each mapping if the 'Prepare' function is successful. This
+// function will stop at and return the first error that occurs, which will include
+// the name of the failing mapping. Any mappings added before the error will be
+// kept.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) AddOrderedContext(x context.Context, pairs ...NameQuery) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	var err error
+	m.acquire()
+	if m.entries == nil {
+		m.entries = make(map[string]*entry, len(pairs))
+	}
+	for i := range pairs {
+		if err = x.Err(); err != nil {
+			break
+		}
+		if err = m.add(x, nil, pairs[i].Name, pairs[i].Query, nil); err != nil {
+			break
+		}
+	}
+	m.release()
 	return err
 }
 
 // ExecContext will attempt to get the statement with the provided name and then
 // attempt to call the 'Exec' function on the statement.
 //
-// This provides the results of the Exec function.
+// This provides the results of the Exec function. If the statement was closed or
+// its connection was lost, the statement will be re-prepared and the call will be
+// retried once.
 //
 // This function specifies a Context that can be used to interrupt and cancel the
 // Exec function.
 func (m *Map) ExecContext(x context.Context, name string, args ...interface{}) (sql.Result, error) {
-	if m.Database == nil {
+	if m == nil || m.database() == nil {
 		return nil, ErrInvalidDB
 	}
-	if len(m.entries) == 0 {
-		return nil, &errval{s: `statement with name "` + name + `" does not exist`}
-	}
-	m.lock.RLock()
-	s, ok := m.entries[name]
-	if m.lock.RUnlock(); !ok || s == nil {
-		return nil, &errval{s: `statement with name "` + name + `" does not exist`}
+	if !m.hooked() {
+		r, _, err := m.exec(x, name, args)
+		return r, err
 	}
-	return s.ExecContext(x, args...)
+	x, f := m.trace(x, name, "Exec")
+	r, e, err := m.exec(x, name, args)
+	f(e, err)
+	return r, err
 }
 
 // QueryContext will attempt to get the statement with the provided name and then
 // attempt to call the 'Query' function on the statement.
 //
-// This provides the results of the Query function.
+// This provides the results of the Query function. If the statement was closed or
+// its connection was lost, the statement will be re-prepared and the call will be
+// retried once.
 //
 // This function specifies a Context that can be used to interrupt and cancel the
 // Query function.
 func (m *Map) QueryContext(x context.Context, name string, args ...interface{}) (*sql.Rows, error) {
-	if m.Database == nil {
+	if m == nil || m.database() == nil {
 		return nil, ErrInvalidDB
 	}
-	if len(m.entries) == 0 {
-		return nil, &errval{s: `statement with name "` + name + `" does not exist`}
-	}
-	m.lock.RLock()
-	s, ok := m.entries[name]
-	if m.lock.RUnlock(); !ok || s == nil {
-		return nil, &errval{s: `statement with name "` + name + `" does not exist`}
+	if !m.hooked() {
+		r, _, err := m.query(x, name, args)
+		return r, err
 	}
-	return s.QueryContext(x, args...)
+	x, f := m.trace(x, name, "Query")
+	r, e, err := m.query(x, name, args)
+	f(e, err)
+	return r, err
 }
 
 // QueryRowContext will attempt to get the statement with the provided name and
@@ -373,16 +2820,301 @@ func (m *Map) QueryContext(x context.Context, name string, args ...interface{})
 // This function specifies a Context that can be used to interrupt and cancel the
 // Query function.
 func (m *Map) QueryRowContext(x context.Context, name string, args ...interface{}) (*sql.Row, bool) {
-	if m.Database == nil {
-		return nil, false
+	r, err := m.QueryRowErrContext(x, name, args...)
+	return r, err == nil
+}
+
+// QueryRowErrContext will attempt to get the statement with the provided name
+// and then attempt to call the 'QueryRow' function on the statement.
+//
+// This function differs from 'QueryRowContext' as this will return an error
+// instead of a boolean, allowing for a nil Database to be distinguished from a
+// missing statement.
+//
+// If the returned error is nil, the result is not-nil and safe to use.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (m *Map) QueryRowErrContext(x context.Context, name string, args ...interface{}) (*sql.Row, error) {
+	if m == nil || m.database() == nil {
+		return nil, ErrInvalidDB
 	}
-	if len(m.entries) == 0 {
-		return nil, false
+	if !m.hooked() {
+		r, _, err := m.queryRow(x, name, args)
+		return r, err
 	}
-	m.lock.RLock()
-	s, ok := m.entries[name]
-	if m.lock.RUnlock(); !ok || s == nil {
-		return nil, false
+	x, f := m.trace(x, name, "QueryRow")
+	r, e, err := m.queryRow(x, name, args)
+	if err == nil {
+		f(e, r.Err())
+	} else {
+		f(e, err)
+	}
+	return r, err
+}
+func (m *Map) exec(x context.Context, name string, args []interface{}) (sql.Result, *entry, error) {
+	return retry(m.RetryPolicy, x, func() (sql.Result, *entry, error) {
+		return intercept(m.middleware(), x, name, "Exec", args, m.execStmt)
+	})
+}
+func (m *Map) execStmt(x context.Context, name string, args []interface{}) (sql.Result, *entry, error) {
+	e, s, err := m.stmt(x, name, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, _, err := m.execEntry(x, name, e, s, args)
+	return r, e, err
+}
+func (m *Map) execEntry(x context.Context, name string, e *entry, s *sql.Stmt, args []interface{}) (sql.Result, *sql.Stmt, error) {
+	if err := m.validate(e, name, false, args); err != nil {
+		return nil, s, err
+	}
+	m.enter(e)
+	defer m.leave(e)
+	if s == nil {
+		r, err := m.runner(e, false).ExecContext(x, e.text, args...)
+		return r, nil, err
+	}
+	r, err := s.ExecContext(x, args...)
+	if err != nil && isStale(err) {
+		n, err := m.reprepare(x, name, s, false)
+		if err != nil {
+			return nil, s, err
+		}
+		r, err = n.ExecContext(x, args...)
+		return r, n, err
+	}
+	return r, s, err
+}
+func (m *Map) query(x context.Context, name string, args []interface{}) (*sql.Rows, *entry, error) {
+	r, e, err := retry(m.RetryPolicy, x, func() (*sql.Rows, *entry, error) {
+		return intercept(m.middleware(), x, name, "Query", args, m.queryStmt)
+	})
+	if err != nil || e == nil || e.cols == nil || e.checked.Load() {
+		return r, e, err
+	}
+	if err = e.verify(name, r); err != nil {
+		r.Close()
+		return nil, e, err
+	}
+	return r, e, nil
+}
+func (m *Map) queryStmt(x context.Context, name string, args []interface{}) (*sql.Rows, *entry, error) {
+	e, s, err := m.stmt(x, name, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = m.validate(e, name, true, args); err != nil {
+		return nil, e, err
+	}
+	m.enter(e)
+	defer m.leave(e)
+	if s == nil {
+		r, err := m.runner(e, true).QueryContext(x, e.text, args...)
+		return r, e, err
+	}
+	r, err := s.QueryContext(x, args...)
+	if err != nil && isStale(err) {
+		if s, err = m.reprepare(x, name, s, true); err != nil {
+			return nil, e, err
+		}
+		r, err = s.QueryContext(x, args...)
+	}
+	return r, e, err
+}
+func (m *Map) queryRow(x context.Context, name string, args []interface{}) (*sql.Row, *entry, error) {
+	return intercept(m.middleware(), x, name, "QueryRow", args, m.queryRowStmt)
+}
+func (m *Map) queryRowStmt(x context.Context, name string, args []interface{}) (*sql.Row, *entry, error) {
+	e, s, err := m.stmt(x, name, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = m.validate(e, name, true, args); err != nil {
+		return nil, e, err
+	}
+	var r *sql.Row
+	if m.enter(e); s == nil {
+		r = m.runner(e, true).QueryRowContext(x, e.text, args...)
+	} else {
+		r = s.QueryRowContext(x, args...)
+	}
+	m.leave(e)
+	return r, e, nil
+}
+
+// QueryRowScanContext will attempt to get the statement with the provided name,
+// call the 'QueryRow' function on the statement and then scan the result into
+// the supplied destination values.
+//
+// This will return an error if the statement does not exist. If no rows were
+// returned, 'sql.ErrNoRows' will be returned unchanged.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (m *Map) QueryRowScanContext(x context.Context, name string, dest []interface{}, args ...interface{}) error {
+	r, err := m.QueryRowErrContext(x, name, args...)
+	if err != nil {
+		return err
+	}
+	return r.Scan(dest...)
+}
+
+// QueryRowExistsContext will attempt to get the statement with the provided name,
+// call the 'Query' function on the statement and return True if at least one row
+// was returned.
+//
+// This will return an error if the statement does not exist or the query fails.
+// Unlike 'QueryRow', no rows being returned is not an error and will instead
+// return False.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (m *Map) QueryRowExistsContext(x context.Context, name string, args ...interface{}) (bool, error) {
+	r, err := m.QueryContext(x, name, args...)
+	if err != nil {
+		return false, err
+	}
+	ok := r.Next()
+	if err = r.Close(); err == nil {
+		err = r.Err()
+	}
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// ExecInsertContext will attempt to get the statement with the provided name,
+// call the 'Exec' function on the statement and return the 'LastInsertId' of the
+// result.
+//
+// Not all drivers support 'LastInsertId' (such as Postgres), for those drivers
+// 'QueryInsert' can be used with a 'RETURNING' clause instead.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Exec function.
+func (m *Map) ExecInsertContext(x context.Context, name string, args ...interface{}) (int64, error) {
+	r, err := m.ExecContext(x, name, args...)
+	if err != nil {
+		return 0, err
+	}
+	return r.LastInsertId()
+}
+
+// QueryInsertContext will attempt to get the statement with the provided name,
+// call the 'QueryRow' function on the statement and return the single returned
+// column as an int64.
+//
+// This is intended for statements using a 'RETURNING' clause to return a newly
+// inserted ID. If no rows were returned, 'sql.ErrNoRows' will be returned.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (m *Map) QueryInsertContext(x context.Context, name string, args ...interface{}) (int64, error) {
+	var v int64
+	if err := m.QueryRowScanContext(x, name, []interface{}{&v}, args...); err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+// QueryIntContext will attempt to get the statement with the provided name, call
+// the 'QueryRow' function on the statement and return the single returned column
+// as an int64. This is intended for statements such as 'SELECT COUNT(*)'.
+//
+// If no rows were returned or the value is NULL, zero and a nil error will be
+// returned. Use 'QueryInsert' if a missing row should return 'sql.ErrNoRows'.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (m *Map) QueryIntContext(x context.Context, name string, args ...interface{}) (int64, error) {
+	var v sql.NullInt64
+	if err := m.QueryRowScanContext(x, name, []interface{}{&v}, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return v.Int64, nil
+}
+
+// QueryFuncContext will attempt to get the statement with the provided name, call
+// the 'Query' function on the statement and then call the supplied function with
+// the returned Rows.
+//
+// The Rows are always closed once the function returns, even if the function
+// returns an error or panics. Any error returned by the function will be
+// returned, otherwise any error from reading or closing the Rows is returned.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (m *Map) QueryFuncContext(x context.Context, name string, f func(*sql.Rows) error, args ...interface{}) error {
+	r, err := m.QueryContext(x, name, args...)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err = f(r); err != nil {
+		return err
+	}
+	if err = r.Err(); err != nil {
+		return err
+	}
+	return r.Close()
+}
+
+// ExecManyContext will attempt to get the statement with the provided name and
+// then call the 'Exec' function on the statement once for each of the supplied
+// argument sets, in order.
+//
+// The statement is only looked up once, but argument validation, middleware,
+// retries and hooks are applied to each argument set.
+//
+// This function will return the total number of rows affected and will stop and
+// return the first error that occurs, which will include the index of the failing
+// argument set. The returned count includes the rows affected before the error.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Exec functions.
+func (m *Map) ExecManyContext(x context.Context, name string, args [][]interface{}) (int64, error) {
+	if m == nil || m.database() == nil {
+		return 0, ErrInvalidDB
+	}
+	e, s, err := m.stmt(x, name, false)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		n int64
+		h = m.hooked()
+		w = m.middleware()
+	)
+	for i := range args {
+		// 's' is updated if the statement is re-prepared, so later sets use
+		// the new statement.
+		y, f := x, (func(*entry, error))(nil)
+		if h {
+			y, f = m.trace(x, name, "Exec")
+		}
+		r, _, err := retry(m.RetryPolicy, y, func() (sql.Result, *entry, error) {
+			return intercept(w, y, name, "Exec", args[i], func(x context.Context, _ string, a []interface{}) (sql.Result, *entry, error) {
+				r, v, err := m.execEntry(x, name, e, s, a)
+				s = v
+				return r, e, err
+			})
+		})
+		if f != nil {
+			f(e, err)
+		}
+		var c int64
+		if err == nil {
+			c, err = r.RowsAffected()
+		}
+		if err != nil {
+			return n, &errval{e: err, s: `error executing mapping "` + name + `" at index ` + strconv.Itoa(i)}
+		}
+		n += c
 	}
-	return s.QueryRowContext(x, args...), true
+	return n, nil
 }
@@ -0,0 +1,401 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var _ driver.NamedValueChecker = (*testConn)(nil)
+
+type testTx struct{}
+type testConn struct {
+	c *testConnector
+}
+type testStmt struct {
+	c *testConnector
+}
+type testRows struct {
+	n int
+}
+type testResult struct{}
+type testConnector struct {
+	lock   sync.Mutex
+	block  chan struct{}
+	named  []driver.NamedValue
+	closes atomic.Int32
+}
+
+func newTestMap(t testing.TB) (*Map, *testConnector) {
+	c := new(testConnector)
+	m := &Map{Database: sql.OpenDB(c)}
+	t.Cleanup(func() { m.Close() })
+	return m, c
+}
+func (testTx) Commit() error {
+	return nil
+}
+func (testTx) Rollback() error {
+	return nil
+}
+func (*testConn) Close() error {
+	return nil
+}
+func (s *testStmt) Close() error {
+	s.c.lock.Lock()
+	b := s.c.block
+	if s.c.lock.Unlock(); b != nil {
+		<-b
+	}
+	return nil
+}
+func (*testRows) Close() error {
+	return nil
+}
+func (*testStmt) NumInput() int {
+	return -1
+}
+func (*testRows) Columns() []string {
+	return []string{"id", "data"}
+}
+func (c *testConnector) Close() error {
+	c.closes.Add(1)
+	return nil
+}
+func (c *testConnector) Driver() driver.Driver {
+	return c
+}
+func (*testConn) Begin() (driver.Tx, error) {
+	return testTx{}, nil
+}
+func (testResult) LastInsertId() (int64, error) {
+	return 0, nil
+}
+func (testResult) RowsAffected() (int64, error) {
+	return 1, nil
+}
+func (r *testRows) Next(d []driver.Value) error {
+	if r.n >= 1 {
+		return io.EOF
+	}
+	r.n++
+	d[0], d[1] = int64(r.n), []byte{0xFF, 0x00, 0xFE}
+	return nil
+}
+func (c *testConnector) Open(string) (driver.Conn, error) {
+	return &testConn{c: c}, nil
+}
+func (c *testConn) Prepare(string) (driver.Stmt, error) {
+	return &testStmt{c: c.c}, nil
+}
+func (*testConn) CheckNamedValue(*driver.NamedValue) error {
+	// Accepting every value allows 'sql.NamedArg' values to reach the driver.
+	return nil
+}
+func (*testStmt) Exec([]driver.Value) (driver.Result, error) {
+	return testResult{}, nil
+}
+func (*testStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &testRows{}, nil
+}
+func (c *testConnector) Connect(context.Context) (driver.Conn, error) {
+	return &testConn{c: c}, nil
+}
+func (s *testStmt) ExecContext(_ context.Context, a []driver.NamedValue) (driver.Result, error) {
+	s.c.lock.Lock()
+	s.c.named = append(s.c.named[:0], a...)
+	s.c.lock.Unlock()
+	return testResult{}, nil
+}
+
+func TestRemoveConcurrent(t *testing.T) {
+	m, _ := newTestMap(t)
+	var w sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		w.Add(1)
+		go func() {
+			defer w.Done()
+			for n := 0; n < 100; n++ {
+				if err := m.Add("test", "SELECT 1"); err != nil && !errors.Is(err, ErrDuplicateName) {
+					t.Errorf("Add failed: %s", err)
+					return
+				}
+				m.Remove("test")
+			}
+		}()
+	}
+	w.Wait()
+	if m.Remove("test"); m.Len() != 0 {
+		t.Fatalf("expected an empty Map, got %d mappings", m.Len())
+	}
+}
+
+func TestCloseConcurrent(t *testing.T) {
+	m, c := newTestMap(t)
+	for _, n := range []string{"a", "b", "c"} {
+		if err := m.Add(n, "SELECT 1"); err != nil {
+			t.Fatalf("Add failed: %s", err)
+		}
+	}
+	var (
+		w sync.WaitGroup
+		s = make(chan struct{})
+	)
+	for i := 0; i < 32; i++ {
+		w.Add(1)
+		go func() {
+			defer w.Done()
+			<-s
+			if err := m.Close(); err != nil {
+				t.Errorf("Close failed: %s", err)
+			}
+		}()
+	}
+	close(s)
+	w.Wait()
+	if n := c.closes.Load(); n != 1 {
+		t.Fatalf("expected the database to be closed once, got %d", n)
+	}
+	if n := m.OpenLen(); n != 0 {
+		t.Fatalf("expected all statements to be closed, got %d open", n)
+	}
+}
+
+func TestExecNamedArgs(t *testing.T) {
+	m, c := newTestMap(t)
+	if err := m.Add("test", "UPDATE t SET a = @a WHERE id = @id"); err != nil {
+		t.Fatalf("Add failed: %s", err)
+	}
+	if _, err := m.ExecNamedArgs("test", sql.Named("a", "value"), sql.Named("id", int64(5))); err != nil {
+		t.Fatalf("ExecNamedArgs failed: %s", err)
+	}
+	c.lock.Lock()
+	v := c.named
+	c.lock.Unlock()
+	if len(v) != 2 {
+		t.Fatalf("expected 2 named values, got %d", len(v))
+	}
+	if v[0].Name != "a" || v[0].Value != "value" || v[1].Name != "id" || v[1].Value != int64(5) {
+		t.Fatalf("unexpected named values: %+v", v)
+	}
+}
+
+func TestCloseContextExpired(t *testing.T) {
+	m, c := newTestMap(t)
+	if err := m.Add("test", "SELECT 1"); err != nil {
+		t.Fatalf("Add failed: %s", err)
+	}
+	b := make(chan struct{})
+	c.lock.Lock()
+	c.block = b
+	c.lock.Unlock()
+	x, f := context.WithTimeout(context.Background(), time.Millisecond*10)
+	err := m.CloseContext(x)
+	if f(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+	if n := m.OpenLen(); n != 0 {
+		t.Fatalf("expected the statement being closed to be detached, got %d open", n)
+	}
+	if err = m.Reprepare("test"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected Reprepare to return ErrNotFound, got %v", err)
+	}
+	c.lock.Lock()
+	c.block = nil
+	c.lock.Unlock()
+	close(b)
+}
+
+func TestRemoveCallback(t *testing.T) {
+	m, c := newTestMap(t)
+	var (
+		r   []string
+		add = func() {
+			for _, n := range []string{"a", "b", "c", "pa", "pb"} {
+				if err := m.Add(n, "SELECT 1"); err != nil {
+					t.Fatalf("Add failed: %s", err)
+				}
+			}
+		}
+	)
+	m.OnRemove = func(n string) { r = append(r, n) }
+	add()
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close failed: %s", err)
+	}
+	// Closed statements are removed without being counted or calling OnRemove.
+	if m.Remove("a") || m.RemoveAll("b", "c") != 0 || m.RemovePrefix("p") != 0 {
+		t.Fatal("expected closed mappings to not be counted")
+	}
+	if len(r) > 0 || m.Len() != 0 {
+		t.Fatalf("expected no callbacks and an empty Map, got %v and %d mappings", r, m.Len())
+	}
+	m.Reset(sql.OpenDB(c))
+	add()
+	if !m.Remove("a") || m.RemoveAll("b", "c", "x") != 2 || m.RemovePrefix("p") != 2 {
+		t.Fatal("expected open mappings to be counted")
+	}
+	if sort.Strings(r); strings.Join(r, ",") != "a,b,c,pa,pb" {
+		t.Fatalf("unexpected callbacks: %v", r)
+	}
+}
+func TestQueryMapsBytes(t *testing.T) {
+	m, _ := newTestMap(t)
+	if err := m.Add("q", "SELECT id, data"); err != nil {
+		t.Fatalf("Add failed: %s", err)
+	}
+	r, err := m.QueryMaps("q")
+	if err != nil {
+		t.Fatalf("QueryMaps failed: %s", err)
+	}
+	if len(r) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(r))
+	}
+	// Binary values must be returned unchanged by default.
+	if b, ok := r[0]["data"].([]byte); !ok || !bytes.Equal(b, []byte{0xFF, 0x00, 0xFE}) {
+		t.Fatalf("expected the []byte value to be kept, got %#v", r[0]["data"])
+	}
+	m.MapStrings = true
+	if r, err = m.QueryMaps("q"); err != nil {
+		t.Fatalf("QueryMaps failed: %s", err)
+	}
+	if v, ok := r[0]["data"].(string); !ok || v != "\xFF\x00\xFE" {
+		t.Fatalf("expected the []byte value to be a string, got %#v", r[0]["data"])
+	}
+	if v, ok := r[0]["id"].(int64); !ok || v != 1 {
+		t.Fatalf("expected the id value to be unchanged, got %#v", r[0]["id"])
+	}
+}
+func TestExecMany(t *testing.T) {
+	m, _ := newTestMap(t)
+	if err := m.Add("e", "INSERT"); err != nil {
+		t.Fatalf("Add failed: %s", err)
+	}
+	var c []int
+	m.Use(func(n ExecFunc) ExecFunc {
+		return func(x context.Context, name, op string, args []interface{}) (interface{}, error) {
+			c = append(c, len(args))
+			return n(x, name, op, args)
+		}
+	})
+	n, err := m.ExecMany("e", [][]interface{}{{1}, {2, 3}, {4, 5, 6}})
+	if err != nil {
+		t.Fatalf("ExecMany failed: %s", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 rows affected, got %d", n)
+	}
+	if len(c) != 3 || c[0] != 1 || c[1] != 2 || c[2] != 3 {
+		t.Fatalf("expected middleware to be called for each set, got %v", c)
+	}
+	if _, err = m.ExecMany("missing", [][]interface{}{{1}}); err == nil {
+		t.Fatal("expected an error for a missing mapping")
+	}
+}
+func TestSingleEntry(t *testing.T) {
+	m, _ := newTestMap(t)
+	if err := m.Add("a", "SELECT 1"); err != nil {
+		t.Fatalf("Add failed: %s", err)
+	}
+	if _, err := m.Exec("a"); err != nil {
+		t.Fatalf("Exec failed: %s", err)
+	}
+	if _, err := m.Exec("b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := m.Add("b", "SELECT 1"); err != nil {
+		t.Fatalf("Add failed: %s", err)
+	}
+	if _, err := m.Exec("b"); err != nil {
+		t.Fatalf("Exec failed: %s", err)
+	}
+	if !m.Remove("b") || !m.Remove("a") {
+		t.Fatal("expected both mappings to be removed")
+	}
+	if _, err := m.Exec("a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after Remove, got %v", err)
+	}
+	if err := m.Add("a", "SELECT 1"); err != nil {
+		t.Fatalf("Add failed: %s", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close failed: %s", err)
+	}
+	if _, err := m.Exec("a"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed after Close, got %v", err)
+	}
+}
+func BenchmarkExecSingle(b *testing.B) {
+	benchmarkExec(b, 1)
+}
+func BenchmarkExecGeneral(b *testing.B) {
+	benchmarkExec(b, 256)
+}
+func BenchmarkQuerySingle(b *testing.B) {
+	benchmarkQuery(b, 1)
+}
+func BenchmarkQueryGeneral(b *testing.B) {
+	benchmarkQuery(b, 256)
+}
+func benchmarkMap(b *testing.B, n int) *Map {
+	m, _ := newTestMap(b)
+	for i := 0; i < n; i++ {
+		if err := m.Add("test"+strconv.Itoa(i), "SELECT 1"); err != nil {
+			b.Fatalf("Add failed: %s", err)
+		}
+	}
+	return m
+}
+func benchmarkExec(b *testing.B, n int) {
+	m := benchmarkMap(b, n)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(p *testing.PB) {
+		for p.Next() {
+			if _, err := m.Exec("test0"); err != nil {
+				b.Errorf("Exec failed: %s", err)
+				return
+			}
+		}
+	})
+}
+func benchmarkQuery(b *testing.B, n int) {
+	m := benchmarkMap(b, n)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(p *testing.PB) {
+		for p.Next() {
+			r, err := m.Query("test0")
+			if err != nil {
+				b.Errorf("Query failed: %s", err)
+				return
+			}
+			r.Close()
+		}
+	})
+}
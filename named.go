@@ -0,0 +1,246 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"context"
+	"database/sql"
+)
+
+// AddNamed will parse the specified query for named parameters, prepare it and
+// add it to the Map with the provided name.
+//
+// Named parameters are identifiers prefixed with a colon, such as ':user_id', and
+// are replaced with positional '?' placeholders before the query is prepared.
+// Colons inside quoted strings and double colons (such as '::int' casts) are
+// ignored.
+//
+// The statement can be executed with named arguments using 'ExecNamed' or
+// 'QueryNamed'. A named parameter may be used multiple times in the query and
+// the same value will be used for each occurrence.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+func (m *Map) AddNamed(name, query string) error {
+	return m.AddNamedContext(context.Background(), name, query)
+}
+
+// ExecNamed will attempt to get the statement with the provided name and then
+// attempt to call the 'Exec' function on the statement, using the supplied map
+// to fill in the named parameters of the query.
+//
+// If a named parameter of the query is missing from the map, an error will be
+// returned before the statement is executed.
+//
+// This provides the results of the Exec function.
+func (m *Map) ExecNamed(name string, args map[string]interface{}) (sql.Result, error) {
+	x, f := m.context(name)
+	r, err := m.ExecNamedContext(x, name, args)
+	f()
+	return r, err
+}
+
+// QueryNamed will attempt to get the statement with the provided name and then
+// attempt to call the 'Query' function on the statement, using the supplied map
+// to fill in the named parameters of the query.
+//
+// If a named parameter of the query is missing from the map, an error will be
+// returned before the statement is executed.
+//
+// This provides the results of the Query function.
+func (m *Map) QueryNamed(name string, args map[string]interface{}) (*sql.Rows, error) {
+	x, _ := m.context(name)
+	return m.QueryNamedContext(x, name, args)
+}
+
+// ExecNamedArgs will attempt to get the statement with the provided name and then
+// attempt to call the 'Exec' function on the statement with the supplied
+// 'sql.NamedArg' arguments.
+//
+// The named arguments are passed directly to the driver, so this can only be used
+// with drivers that support named parameters natively. Use 'AddNamed' and
+// 'ExecNamed' for drivers that do not.
+//
+// This provides the results of the Exec function.
+func (m *Map) ExecNamedArgs(name string, args ...sql.NamedArg) (sql.Result, error) {
+	x, f := m.context(name)
+	r, err := m.ExecNamedArgsContext(x, name, args...)
+	f()
+	return r, err
+}
+
+// QueryNamedArgs will attempt to get the statement with the provided name and
+// then attempt to call the 'Query' function on the statement with the supplied
+// 'sql.NamedArg' arguments.
+//
+// The named arguments are passed directly to the driver, so this can only be used
+// with drivers that support named parameters natively. Use 'AddNamed' and
+// 'QueryNamed' for drivers that do not.
+//
+// This provides the results of the Query function.
+func (m *Map) QueryNamedArgs(name string, args ...sql.NamedArg) (*sql.Rows, error) {
+	x, _ := m.context(name)
+	return m.QueryNamedArgsContext(x, name, args...)
+}
+
+// AddNamedContext will parse the specified query for named parameters, prepare
+// it and add it to the Map with the provided name.
+//
+// Named parameters are identifiers prefixed with a colon, such as ':user_id', and
+// are replaced with positional '?' placeholders before the query is prepared.
+// Colons inside quoted strings and double colons (such as '::int' casts) are
+// ignored.
+//
+// This function does not allow for adding a mapping when one already exists. If
+// a mapping with an overlapping name is attempted, an error wrapping 'ErrDuplicateName'
+// will be returned before attempting to prepare the query.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare call.
+func (m *Map) AddNamedContext(x context.Context, name, query string) error {
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	q, p := parseNamed(query)
+	m.acquire()
+	if m.entries == nil {
+		m.entries = make(map[string]*entry, 1)
+	}
+	err := m.add(x, nil, name, q, p)
+	m.release()
+	return err
+}
+
+// ExecNamedContext will attempt to get the statement with the provided name and
+// then attempt to call the 'Exec' function on the statement, using the supplied
+// map to fill in the named parameters of the query.
+//
+// If a named parameter of the query is missing from the map, an error will be
+// returned before the statement is executed.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Exec function.
+func (m *Map) ExecNamedContext(x context.Context, name string, args map[string]interface{}) (sql.Result, error) {
+	a, err := m.named(name, args)
+	if err != nil {
+		return nil, err
+	}
+	return m.ExecContext(x, name, a...)
+}
+
+// QueryNamedContext will attempt to get the statement with the provided name and
+// then attempt to call the 'Query' function on the statement, using the supplied
+// map to fill in the named parameters of the query.
+//
+// If a named parameter of the query is missing from the map, an error will be
+// returned before the statement is executed.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (m *Map) QueryNamedContext(x context.Context, name string, args map[string]interface{}) (*sql.Rows, error) {
+	a, err := m.named(name, args)
+	if err != nil {
+		return nil, err
+	}
+	return m.QueryContext(x, name, a...)
+}
+
+// ExecNamedArgsContext will attempt to get the statement with the provided name
+// and then attempt to call the 'Exec' function on the statement with the supplied
+// 'sql.NamedArg' arguments.
+//
+// The named arguments are passed directly to the driver, so this can only be used
+// with drivers that support named parameters natively. Use 'AddNamed' and
+// 'ExecNamed' for drivers that do not.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Exec function.
+func (m *Map) ExecNamedArgsContext(x context.Context, name string, args ...sql.NamedArg) (sql.Result, error) {
+	return m.ExecContext(x, name, namedArgs(args)...)
+}
+
+// QueryNamedArgsContext will attempt to get the statement with the provided name
+// and then attempt to call the 'Query' function on the statement with the supplied
+// 'sql.NamedArg' arguments.
+//
+// The named arguments are passed directly to the driver, so this can only be used
+// with drivers that support named parameters natively. Use 'AddNamed' and
+// 'QueryNamed' for drivers that do not.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (m *Map) QueryNamedArgsContext(x context.Context, name string, args ...sql.NamedArg) (*sql.Rows, error) {
+	return m.QueryContext(x, name, namedArgs(args)...)
+}
+func namedArgs(a []sql.NamedArg) []interface{} {
+	r := make([]interface{}, len(a))
+	for i := range a {
+		r[i] = a[i]
+	}
+	return r
+}
+func isIdent(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	}
+	return false
+}
+func parseNamed(q string) (string, []string) {
+	var (
+		b = make([]byte, 0, len(q))
+		p []string
+		l int
+	)
+	placeholders(q, func(i int) {
+		if q[i] != ':' {
+			return
+		}
+		n := i + 1
+		for n < len(q) && isIdent(q[n], false) {
+			n++
+		}
+		p = append(p, q[i+1:n])
+		b = append(append(b, q[l:i]...), '?')
+		l = n
+	})
+	return string(append(b, q[l:]...)), p
+}
+func (m *Map) named(name string, args map[string]interface{}) ([]interface{}, error) {
+	if m == nil {
+		return nil, ErrInvalidDB
+	}
+	m.lock.RLock()
+	e, ok := m.entries[name]
+	if m.lock.RUnlock(); !ok || e == nil {
+		return nil, &errval{e: ErrNotFound, s: `mapping "` + name + `"`}
+	}
+	if len(e.params) == 0 {
+		return nil, nil
+	}
+	a := make([]interface{}, len(e.params))
+	for i := range e.params {
+		v, ok := args[e.params[i]]
+		if !ok {
+			return nil, &errval{s: `mapping "` + name + `" is missing named parameter "` + e.params[i] + `"`}
+		}
+		a[i] = v
+	}
+	return a, nil
+}
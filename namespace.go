@@ -0,0 +1,139 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// Namespace is a struct that provides a view of a Map where every statement name
+// is prefixed with the Namespace prefix and a ".". This can be used to group the
+// statements of separate modules so that their names do not collide.
+//
+// Namespaces are created by the 'Namespace' function of a Map and do not hold
+// any statements themselves, so any number of them can be created.
+type Namespace struct {
+	m *Map
+	p string
+}
+
+// Namespace returns a Namespace view of this Map using the supplied prefix. Any
+// names passed to the functions of the returned Namespace will be prefixed with
+// the prefix and a "." before being passed to this Map.
+func (m *Map) Namespace(prefix string) *Namespace {
+	return &Namespace{m: m, p: prefix + "."}
+}
+
+// Map returns the Map that this Namespace uses.
+func (n *Namespace) Map() *Map {
+	return n.m
+}
+
+// Names returns a list of the full names (including the prefix) of all the
+// statements currently mapped in this Namespace.
+//
+// The returned slice is a copy and is in no particular order. Any closed
+// statements will be omitted.
+func (n *Namespace) Names() []string {
+	r := n.m.Names()
+	o := r[:0]
+	for i := range r {
+		if strings.HasPrefix(r[i], n.p) {
+			o = append(o, r[i])
+		}
+	}
+	return o
+}
+
+// Add will prepare and add the specified query to the Map with the provided name
+// prefixed by the Namespace.
+//
+// This will only add the mapping if the 'Prepare' function is successful. Otherwise
+// the prepare error will be returned.
+func (n *Namespace) Add(name, query string) error {
+	return n.m.Add(n.p+name, query)
+}
+
+// Exec will attempt to get the statement with the provided name prefixed by the
+// Namespace and then attempt to call the 'Exec' function on the statement.
+//
+// This provides the results of the Exec function.
+func (n *Namespace) Exec(name string, args ...interface{}) (sql.Result, error) {
+	return n.m.Exec(n.p+name, args...)
+}
+
+// Query will attempt to get the statement with the provided name prefixed by the
+// Namespace and then attempt to call the 'Query' function on the statement.
+//
+// This provides the results of the Query function.
+func (n *Namespace) Query(name string, args ...interface{}) (*sql.Rows, error) {
+	return n.m.Query(n.p+name, args...)
+}
+
+// QueryRow will attempt to get the statement with the provided name prefixed by
+// the Namespace and then attempt to call the 'QueryRow' function on the statement.
+//
+// If the returned boolean is True, the result is not-nil and safe to use.
+func (n *Namespace) QueryRow(name string, args ...interface{}) (*sql.Row, bool) {
+	return n.m.QueryRow(n.p+name, args...)
+}
+
+// AddContext will prepare and add the specified query to the Map with the provided
+// name prefixed by the Namespace.
+//
+// This will only add the mapping if the 'Prepare' function is successful. Otherwise
+// the prepare error will be returned.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (n *Namespace) AddContext(x context.Context, name, query string) error {
+	return n.m.AddContext(x, n.p+name, query)
+}
+
+// ExecContext will attempt to get the statement with the provided name prefixed
+// by the Namespace and then attempt to call the 'Exec' function on the statement.
+//
+// This provides the results of the Exec function.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Exec function.
+func (n *Namespace) ExecContext(x context.Context, name string, args ...interface{}) (sql.Result, error) {
+	return n.m.ExecContext(x, n.p+name, args...)
+}
+
+// QueryContext will attempt to get the statement with the provided name prefixed
+// by the Namespace and then attempt to call the 'Query' function on the statement.
+//
+// This provides the results of the Query function.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (n *Namespace) QueryContext(x context.Context, name string, args ...interface{}) (*sql.Rows, error) {
+	return n.m.QueryContext(x, n.p+name, args...)
+}
+
+// QueryRowContext will attempt to get the statement with the provided name prefixed
+// by the Namespace and then attempt to call the 'QueryRow' function on the statement.
+//
+// If the returned boolean is True, the result is not-nil and safe to use.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (n *Namespace) QueryRowContext(x context.Context, name string, args ...interface{}) (*sql.Row, bool) {
+	return n.m.QueryRowContext(x, n.p+name, args...)
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"context"
+	"database/sql"
+)
+
+// ExecRaw will call the 'Exec' function on the Database with the provided query
+// without preparing or adding it to the Map.
+//
+// This is useful for one-off queries that will not be used again.
+func (m *Map) ExecRaw(query string, args ...interface{}) (sql.Result, error) {
+	x, f := m.context("")
+	r, err := m.ExecRawContext(x, query, args...)
+	f()
+	return r, err
+}
+
+// QueryRaw will call the 'Query' function on the Database with the provided query
+// without preparing or adding it to the Map.
+//
+// This is useful for one-off queries that will not be used again.
+func (m *Map) QueryRaw(query string, args ...interface{}) (*sql.Rows, error) {
+	x, _ := m.context("")
+	return m.QueryRawContext(x, query, args...)
+}
+
+// ExecRawContext will call the 'Exec' function on the Database with the provided
+// query without preparing or adding it to the Map.
+//
+// This is useful for one-off queries that will not be used again.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Exec function.
+func (m *Map) ExecRawContext(x context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if m == nil || m.database() == nil {
+		return nil, ErrInvalidDB
+	}
+	return m.database().ExecContext(x, query, args...)
+}
+
+// QueryRawContext will call the 'Query' function on the Database with the provided
+// query without preparing or adding it to the Map.
+//
+// This is useful for one-off queries that will not be used again.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (m *Map) QueryRawContext(x context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if m == nil || m.database() == nil {
+		return nil, ErrInvalidDB
+	}
+	return m.database().QueryContext(x, query, args...)
+}
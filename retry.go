@@ -0,0 +1,69 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"context"
+	"time"
+)
+
+// RetryPolicy is a struct that can be set on a Map to automatically re-run
+// statements that fail with a transient error, such as a deadlock or a
+// serialization failure.
+//
+// Retries only apply to the 'Exec' and 'Query' functions (and their Context
+// variants) and not to the 'QueryRow' functions or statements executed inside
+// a Tx. Retries should only be used with statements that are safe to run more
+// than once. The Context supplied to the execution function bounds the total
+// time spent, including any time spent waiting between attempts.
+type RetryPolicy struct {
+	// Retryable is a function that returns True if the supplied error should
+	// cause the statement to be executed again. If nil, no errors are retried.
+	Retryable func(err error) bool
+	// Attempts is the maximum number of times a statement will be executed,
+	// including the first attempt. Values less than two disable retries.
+	Attempts int
+	// Backoff is the time to wait before the first retry. The wait is doubled
+	// after each retry.
+	Backoff time.Duration
+	// MaxBackoff is an optional limit for the time waited between retries. A
+	// value of zero means there is no limit.
+	MaxBackoff time.Duration
+}
+
+func retry[T any](p *RetryPolicy, x context.Context, f func() (T, *entry, error)) (T, *entry, error) {
+	r, e, err := f()
+	if p == nil || p.Retryable == nil || p.Attempts < 2 {
+		return r, e, err
+	}
+	d := p.Backoff
+	for i := 1; i < p.Attempts && err != nil && p.Retryable(err); i++ {
+		if d > 0 {
+			t := time.NewTimer(d)
+			select {
+			case <-x.Done():
+				t.Stop()
+				return r, e, err
+			case <-t.C:
+			}
+			if d *= 2; p.MaxBackoff > 0 && d > p.MaxBackoff {
+				d = p.MaxBackoff
+			}
+		}
+		r, e, err = f()
+	}
+	return r, e, err
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"context"
+	"database/sql"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Rows is a wrapper around the '*sql.Rows' returned by the 'QueryManaged'
+// functions. Rows are closed automatically when 'Next' returns False or if an
+// error occurs while scanning, but should still be closed by the caller.
+//
+// If the 'RowsWarning' property of the Map is set, a warning will be logged for
+// Rows left open longer than the set duration. Rows that are garbage collected
+// without being closed will be logged and closed.
+type Rows struct {
+	r    *sql.Rows
+	t    *time.Timer
+	f    func()
+	once sync.Once
+}
+
+// Rows returns the underlying '*sql.Rows'.
+func (r *Rows) Rows() *sql.Rows {
+	return r.r
+}
+
+// Err returns the error, if any, that was encountered during iteration.
+func (r *Rows) Err() error {
+	return r.r.Err()
+}
+
+// Next prepares the next result row for reading with the 'Scan' function. It
+// returns True on success or False if there is no next result row or an error
+// happened while preparing it. The Rows will be closed when this returns False.
+func (r *Rows) Next() bool {
+	if r.r.Next() {
+		return true
+	}
+	r.Close()
+	return false
+}
+
+// Close will close the Rows, returning the connection to the pool. This function
+// is safe to call multiple times.
+func (r *Rows) Close() error {
+	err := r.r.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// Columns returns the column names of the Rows.
+func (r *Rows) Columns() ([]string, error) {
+	return r.r.Columns()
+}
+
+// Scan copies the columns in the current row into the values pointed at by the
+// supplied arguments. See '(*sql.Rows).Scan' for more details.
+//
+// If the scan fails, the Rows will be closed.
+func (r *Rows) Scan(v ...interface{}) error {
+	if err := r.r.Scan(v...); err != nil {
+		r.Close()
+		return err
+	}
+	return nil
+}
+
+// QueryManaged will attempt to get the statement with the provided name and then
+// attempt to call the 'Query' function on the statement, returning the results
+// as managed Rows.
+//
+// Unlike 'Query', the Map Timeout Context is released when the returned Rows
+// are closed. See 'Rows' for more details.
+func (m *Map) QueryManaged(name string, args ...interface{}) (*Rows, error) {
+	x, f := m.context(name)
+	r, err := m.queryManaged(x, f, name, args)
+	if err != nil {
+		f()
+	}
+	return r, err
+}
+
+// QueryManagedContext will attempt to get the statement with the provided name
+// and then attempt to call the 'Query' function on the statement, returning the
+// results as managed Rows.
+//
+// See 'Rows' for more details.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (m *Map) QueryManagedContext(x context.Context, name string, args ...interface{}) (*Rows, error) {
+	return m.queryManaged(x, nil, name, args)
+}
+func (r *Rows) release() {
+	if r.t != nil {
+		r.t.Stop()
+	}
+	if r.f != nil {
+		r.f()
+	}
+	runtime.SetFinalizer(r, nil)
+}
+func (m *Map) queryManaged(x context.Context, f func(), name string, args []interface{}) (*Rows, error) {
+	q, err := m.QueryContext(x, name, args...)
+	if err != nil {
+		return nil, err
+	}
+	r := &Rows{r: q, f: f}
+	if m.RowsWarning > 0 {
+		d := m.RowsWarning
+		r.t = time.AfterFunc(d, func() {
+			m.logf(`rows for mapping "%s" have been open for longer than %s`, name, d)
+		})
+	}
+	runtime.SetFinalizer(r, func(r *Rows) {
+		m.logf(`rows for mapping "%s" were not closed`, name)
+		r.Close()
+	})
+	return r, nil
+}
@@ -0,0 +1,477 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	fieldCache  sync.Map
+	timeType    = reflect.TypeOf(time.Time{})
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+type scanner struct {
+	f [][]int
+	s bool
+}
+
+// QueryStruct will attempt to get the statement with the provided name and then
+// attempt to call the 'Query' function on the statement, scanning the first
+// returned row into a new value of type T.
+//
+// If T is a struct, each column will be matched to an exported field with the
+// same name (case insensitive) or with a 'db:"<column>"' tag. Fields tagged with
+// 'db:"-"' are ignored. If any column does not match a field, an error will be
+// returned. If T is not a struct, is a 'time.Time' or implements 'sql.Scanner'
+// (such as 'sql.NullInt64'), the query must return a single column that will be
+// scanned directly into the value.
+//
+// If no rows are returned, 'sql.ErrNoRows' will be returned.
+func QueryStruct[T any](m *Map, name string, args ...interface{}) (T, error) {
+	x, f := m.context(name)
+	v, err := QueryStructContext[T](m, x, name, args...)
+	f()
+	return v, err
+}
+
+// QueryStructContext will attempt to get the statement with the provided name and
+// then attempt to call the 'Query' function on the statement, scanning the first
+// returned row into a new value of type T.
+//
+// If T is a struct, each column will be matched to an exported field with the
+// same name (case insensitive) or with a 'db:"<column>"' tag. Fields tagged with
+// 'db:"-"' are ignored. If any column does not match a field, an error will be
+// returned. If T is not a struct, is a 'time.Time' or implements 'sql.Scanner'
+// (such as 'sql.NullInt64'), the query must return a single column that will be
+// scanned directly into the value.
+//
+// If no rows are returned, 'sql.ErrNoRows' will be returned.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func QueryStructContext[T any](m *Map, x context.Context, name string, args ...interface{}) (T, error) {
+	var v T
+	r, err := m.QueryContext(x, name, args...)
+	if err != nil {
+		return v, err
+	}
+	if !r.Next() {
+		if err = r.Err(); err == nil {
+			err = sql.ErrNoRows
+		}
+		r.Close()
+		return v, err
+	}
+	s, err := newScanner[T](r)
+	if err == nil {
+		err = s.scan(r, reflect.ValueOf(&v).Elem())
+	}
+	if c := r.Close(); err == nil {
+		err = c
+	}
+	return v, err
+}
+
+// QuerySlice will attempt to get the statement with the provided name and then
+// attempt to call the 'Query' function on the statement, scanning every returned
+// row into a new value of type T.
+//
+// Values are scanned using the same rules as 'QueryStruct'. If no rows are
+// returned, an empty non-nil slice will be returned.
+func QuerySlice[T any](m *Map, name string, args ...interface{}) ([]T, error) {
+	x, f := m.context(name)
+	v, err := QuerySliceContext[T](m, x, name, args...)
+	f()
+	return v, err
+}
+
+// QuerySliceContext will attempt to get the statement with the provided name and
+// then attempt to call the 'Query' function on the statement, scanning every
+// returned row into a new value of type T.
+//
+// Values are scanned using the same rules as 'QueryStruct'. If no rows are
+// returned, an empty non-nil slice will be returned.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func QuerySliceContext[T any](m *Map, x context.Context, name string, args ...interface{}) ([]T, error) {
+	r, err := m.QueryContext(x, name, args...)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		o = make([]T, 0)
+		s *scanner
+	)
+	for r.Next() {
+		var v T
+		if s == nil {
+			if s, err = newScanner[T](r); err != nil {
+				break
+			}
+		}
+		if err = s.scan(r, reflect.ValueOf(&v).Elem()); err != nil {
+			break
+		}
+		o = append(o, v)
+	}
+	if err == nil {
+		err = r.Err()
+	}
+	if c := r.Close(); err == nil {
+		err = c
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// QueryColumn will attempt to get the statement with the provided name and then
+// attempt to call the 'Query' function on the statement, scanning the first
+// column of every returned row into a new value of type T.
+//
+// Any other columns returned are ignored. If the query does not return any
+// columns, an error will be returned. If no rows are returned, an empty non-nil
+// slice will be returned. The returned Rows are always closed.
+func QueryColumn[T any](m *Map, name string, args ...interface{}) ([]T, error) {
+	x, f := m.context(name)
+	v, err := QueryColumnContext[T](m, x, name, args...)
+	f()
+	return v, err
+}
+
+// QueryColumnContext will attempt to get the statement with the provided name
+// and then attempt to call the 'Query' function on the statement, scanning the
+// first column of every returned row into a new value of type T.
+//
+// Any other columns returned are ignored. If the query does not return any
+// columns, an error will be returned. If no rows are returned, an empty non-nil
+// slice will be returned. The returned Rows are always closed.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func QueryColumnContext[T any](m *Map, x context.Context, name string, args ...interface{}) ([]T, error) {
+	r, err := m.QueryContext(x, name, args...)
+	if err != nil {
+		return nil, err
+	}
+	o, err := scanColumn[T](r, name)
+	if c := r.Close(); err == nil {
+		err = c
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// QueryEach will attempt to get the statement with the provided name and then
+// attempt to call the 'Query' function on the statement, scanning each returned
+// row into a new value of type T and calling the supplied function with it.
+//
+// Values are scanned using the same rules as 'QueryStruct'. Rows are processed
+// one at a time, so large results can be handled without reading them all into
+// memory. If the function returns an error, no more rows will be read and the
+// error will be returned. The returned Rows are always closed.
+func QueryEach[T any](m *Map, name string, f func(T) error, args ...interface{}) error {
+	x, c := m.context(name)
+	err := QueryEachContext[T](m, x, name, f, args...)
+	c()
+	return err
+}
+
+// QueryEachContext will attempt to get the statement with the provided name and
+// then attempt to call the 'Query' function on the statement, scanning each
+// returned row into a new value of type T and calling the supplied function with
+// it.
+//
+// Values are scanned using the same rules as 'QueryStruct'. Rows are processed
+// one at a time, so large results can be handled without reading them all into
+// memory. If the function returns an error, no more rows will be read and the
+// error will be returned. The returned Rows are always closed.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func QueryEachContext[T any](m *Map, x context.Context, name string, f func(T) error, args ...interface{}) error {
+	r, err := m.QueryContext(x, name, args...)
+	if err != nil {
+		return err
+	}
+	var s *scanner
+	for r.Next() {
+		var v T
+		if s == nil {
+			if s, err = newScanner[T](r); err != nil {
+				break
+			}
+		}
+		if err = s.scan(r, reflect.ValueOf(&v).Elem()); err != nil {
+			break
+		}
+		if err = f(v); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = r.Err()
+	}
+	if c := r.Close(); err == nil {
+		err = c
+	}
+	return err
+}
+func scanColumn[T any](r *sql.Rows, name string) ([]T, error) {
+	c, err := r.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if len(c) == 0 {
+		return nil, &errval{s: `mapping "` + name + `" did not return any columns`}
+	}
+	var (
+		o = make([]T, 0)
+		d = make([]interface{}, len(c))
+		v T
+	)
+	// Any extra columns are scanned into placeholders and discarded.
+	d[0] = &v
+	for i := 1; i < len(d); i++ {
+		d[i] = new(interface{})
+	}
+	for r.Next() {
+		if err = r.Scan(d...); err != nil {
+			return nil, err
+		}
+		o = append(o, v)
+	}
+	if err = r.Err(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+func fields(t reflect.Type) map[string][]int {
+	if v, ok := fieldCache.Load(t); ok {
+		return v.(map[string][]int)
+	}
+	f := make(map[string][]int, t.NumField())
+	addFields(f, t, nil)
+	fieldCache.Store(t, f)
+	return f
+}
+func newScanner[T any](r *sql.Rows) (*scanner, error) {
+	c, err := r.Columns()
+	if err != nil {
+		return nil, err
+	}
+	// TypeOf is used on a pointer so interface types do not return nil.
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	switch t.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Map, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return nil, &errval{s: "cannot scan into " + t.String()}
+	case reflect.Interface:
+		if t.NumMethod() > 0 {
+			return nil, &errval{s: "cannot scan into " + t.String()}
+		}
+	}
+	// Structs that implement 'sql.Scanner' (such as 'sql.NullInt64') and Time
+	// values are scanned directly instead of being mapped by field.
+	if t.Kind() != reflect.Struct || t == timeType || reflect.PointerTo(t).Implements(scannerType) {
+		if len(c) != 1 {
+			return nil, &errval{s: "query must return a single column to scan into " + t.String()}
+		}
+		return &scanner{s: true}, nil
+	}
+	var (
+		f = fields(t)
+		s = &scanner{f: make([][]int, len(c))}
+	)
+	for i := range c {
+		x, ok := f[strings.ToLower(c[i])]
+		if !ok {
+			return nil, &errval{s: `column "` + c[i] + `" has no matching field in ` + t.String()}
+		}
+		s.f[i] = x
+	}
+	return s, nil
+}
+func addFields(f map[string][]int, t reflect.Type, p []int) {
+	for i := 0; i < t.NumField(); i++ {
+		v := t.Field(i)
+		n, ok := v.Tag.Lookup("db")
+		if n == "-" {
+			continue
+		}
+		x := append(append(make([]int, 0, len(p)+1), p...), i)
+		if v.Anonymous && !ok && v.Type.Kind() == reflect.Struct {
+			addFields(f, v.Type, x)
+			continue
+		}
+		if !v.IsExported() {
+			continue
+		}
+		if !ok || len(n) == 0 {
+			n = v.Name
+		}
+		if n = strings.ToLower(n); len(p) > 0 {
+			if _, ok := f[n]; ok {
+				continue
+			}
+		}
+		f[n] = x
+	}
+}
+func (s *scanner) scan(r *sql.Rows, v reflect.Value) error {
+	if s.s {
+		return r.Scan(v.Addr().Interface())
+	}
+	d := make([]interface{}, len(s.f))
+	for i := range s.f {
+		d[i] = v.FieldByIndex(s.f[i]).Addr().Interface()
+	}
+	return r.Scan(d...)
+}
+
+// QueryMaps will attempt to get the statement with the provided name and then
+// attempt to call the 'Query' function on the statement, returning each row as
+// a map of column names to values.
+//
+// Any '[]byte' values are returned as-is, unless the 'MapStrings' property of
+// the Map is True, which will convert them to strings instead. The returned Rows
+// are always closed. If no rows are returned, an empty non-nil slice will be
+// returned.
+func (m *Map) QueryMaps(name string, args ...interface{}) ([]map[string]interface{}, error) {
+	x, f := m.context(name)
+	r, err := m.QueryMapsContext(x, name, args...)
+	f()
+	return r, err
+}
+
+// QueryMapsContext will attempt to get the statement with the provided name and
+// then attempt to call the 'Query' function on the statement, returning each row
+// as a map of column names to values.
+//
+// Any '[]byte' values are returned as-is, unless the 'MapStrings' property of
+// the Map is True, which will convert them to strings instead. The returned Rows
+// are always closed. If no rows are returned, an empty non-nil slice will be
+// returned.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (m *Map) QueryMapsContext(x context.Context, name string, args ...interface{}) ([]map[string]interface{}, error) {
+	r, err := m.QueryContext(x, name, args...)
+	if err != nil {
+		return nil, err
+	}
+	o, err := scanMaps(r, m.MapStrings)
+	if c := r.Close(); err == nil {
+		err = c
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+func scanMaps(r *sql.Rows, s bool) ([]map[string]interface{}, error) {
+	c, err := r.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		o = make([]map[string]interface{}, 0)
+		v = make([]interface{}, len(c))
+		d = make([]interface{}, len(c))
+	)
+	for i := range v {
+		d[i] = &v[i]
+	}
+	for r.Next() {
+		if err = r.Scan(d...); err != nil {
+			return nil, err
+		}
+		e := make(map[string]interface{}, len(c))
+		for i := range c {
+			if b, ok := v[i].([]byte); ok && s {
+				e[c[i]] = string(b)
+			} else {
+				e[c[i]] = v[i]
+			}
+		}
+		o = append(o, e)
+	}
+	if err = r.Err(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// QueryAll will attempt to get the statement with the provided name and then
+// attempt to call the 'Query' function on the statement, returning the rows of
+// each result set as maps of column names to values.
+//
+// This can be used with statements (such as stored procedures) that return
+// multiple result sets. Each result set is converted using the same rules as
+// 'QueryMaps'. The returned Rows are always closed.
+func (m *Map) QueryAll(name string, args ...interface{}) ([][]map[string]interface{}, error) {
+	x, f := m.context(name)
+	r, err := m.QueryAllContext(x, name, args...)
+	f()
+	return r, err
+}
+
+// QueryAllContext will attempt to get the statement with the provided name and
+// then attempt to call the 'Query' function on the statement, returning the rows
+// of each result set as maps of column names to values.
+//
+// This can be used with statements (such as stored procedures) that return
+// multiple result sets. Each result set is converted using the same rules as
+// 'QueryMaps'. The returned Rows are always closed.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (m *Map) QueryAllContext(x context.Context, name string, args ...interface{}) ([][]map[string]interface{}, error) {
+	r, err := m.QueryContext(x, name, args...)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		o [][]map[string]interface{}
+		v []map[string]interface{}
+	)
+	for {
+		if v, err = scanMaps(r, m.MapStrings); err != nil {
+			break
+		}
+		if o = append(o, v); !r.NextResultSet() {
+			err = r.Err()
+			break
+		}
+	}
+	if c := r.Close(); err == nil {
+		err = c
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
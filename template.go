@@ -0,0 +1,202 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"text/template"
+)
+
+type tmpl struct {
+	t     *template.Template
+	cache map[string]*sql.Stmt
+}
+
+// AddTemplate will parse the specified 'text/template' query template and add it
+// to the Map with the provided name. Templates can be used for queries that can
+// not be expressed with bind arguments, such as queries with a table name that
+// is chosen at runtime.
+//
+// Templates are used with the 'ExecTemplate' and 'QueryTemplate' functions and
+// are separate from the statements of the Map, so they are not included in any
+// of the statement functions, such as 'Names' or 'Get'.
+//
+// Template data is inserted into the query text as-is, so it must never include
+// untrusted input. Any parse errors will be returned.
+func (m *Map) AddTemplate(name, query string) error {
+	if m == nil {
+		return ErrInvalidDB
+	}
+	t, err := template.New(name).Parse(query)
+	if err != nil {
+		return &errval{e: err, s: `error parsing template "` + name + `"`}
+	}
+	m.lock.Lock()
+	if _, ok := m.templates[name]; ok {
+		m.lock.Unlock()
+		return &errval{e: ErrDuplicateName, s: `template "` + name + `"`}
+	}
+	if m.templates == nil {
+		m.templates = make(map[string]*tmpl, 1)
+	}
+	m.templates[name] = &tmpl{t: t}
+	m.lock.Unlock()
+	return nil
+}
+
+// ExecTemplate will render the template with the provided name using the supplied
+// data and then attempt to call the 'Exec' function on the rendered query.
+//
+// Each distinct rendered query is prepared once and cached until the Map is
+// closed, so templates should only render a limited number of distinct queries.
+//
+// This provides the results of the Exec function.
+func (m *Map) ExecTemplate(name string, data interface{}, args ...interface{}) (sql.Result, error) {
+	x, f := m.context("")
+	r, err := m.ExecTemplateContext(x, name, data, args...)
+	f()
+	return r, err
+}
+
+// QueryTemplate will render the template with the provided name using the supplied
+// data and then attempt to call the 'Query' function on the rendered query.
+//
+// Each distinct rendered query is prepared once and cached until the Map is
+// closed, so templates should only render a limited number of distinct queries.
+//
+// This provides the results of the Query function.
+func (m *Map) QueryTemplate(name string, data interface{}, args ...interface{}) (*sql.Rows, error) {
+	x, _ := m.context("")
+	return m.QueryTemplateContext(x, name, data, args...)
+}
+
+// ExecTemplateContext will render the template with the provided name using the
+// supplied data and then attempt to call the 'Exec' function on the rendered query.
+//
+// Each distinct rendered query is prepared once and cached until the Map is
+// closed, so templates should only render a limited number of distinct queries.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Exec function.
+func (m *Map) ExecTemplateContext(x context.Context, name string, data interface{}, args ...interface{}) (sql.Result, error) {
+	if m.hooked() {
+		var f func(*entry, error)
+		x, f = m.trace(x, name, "Exec")
+		r, err := m.execTemplate(x, name, data, args)
+		f(nil, err)
+		return r, err
+	}
+	return m.execTemplate(x, name, data, args)
+}
+
+// QueryTemplateContext will render the template with the provided name using the
+// supplied data and then attempt to call the 'Query' function on the rendered
+// query.
+//
+// Each distinct rendered query is prepared once and cached until the Map is
+// closed, so templates should only render a limited number of distinct queries.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (m *Map) QueryTemplateContext(x context.Context, name string, data interface{}, args ...interface{}) (*sql.Rows, error) {
+	if m.hooked() {
+		var f func(*entry, error)
+		x, f = m.trace(x, name, "Query")
+		r, err := m.queryTemplate(x, name, data, args)
+		f(nil, err)
+		return r, err
+	}
+	return m.queryTemplate(x, name, data, args)
+}
+func (m *Map) execTemplate(x context.Context, name string, data interface{}, args []interface{}) (sql.Result, error) {
+	s, q, err := m.render(x, name, data)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return m.database().ExecContext(x, q, args...)
+	}
+	return s.ExecContext(x, args...)
+}
+func (m *Map) queryTemplate(x context.Context, name string, data interface{}, args []interface{}) (*sql.Rows, error) {
+	s, q, err := m.render(x, name, data)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return m.database().QueryContext(x, q, args...)
+	}
+	return s.QueryContext(x, args...)
+}
+func (m *Map) render(x context.Context, name string, data interface{}) (*sql.Stmt, string, error) {
+	if m == nil || m.database() == nil {
+		return nil, "", ErrInvalidDB
+	}
+	m.lock.RLock()
+	t, ok := m.templates[name]
+	if m.lock.RUnlock(); !ok {
+		return nil, "", &errval{e: ErrNotFound, s: `template "` + name + `"`}
+	}
+	var b strings.Builder
+	if err := t.t.Execute(&b, data); err != nil {
+		return nil, "", &errval{e: err, s: `error rendering template "` + name + `"`}
+	}
+	q := m.Dialect.rewrite(b.String())
+	if m.Passthrough {
+		return nil, q, nil
+	}
+	m.lock.RLock()
+	s, ok := t.cache[q]
+	if m.lock.RUnlock(); ok {
+		return s, q, nil
+	}
+	m.lock.Lock()
+	if s, ok = t.cache[q]; ok {
+		m.lock.Unlock()
+		return s, q, nil
+	}
+	s, err := m.database().PrepareContext(x, q)
+	if err != nil {
+		m.lock.Unlock()
+		if isClosed(err) {
+			return nil, "", ErrClosed
+		}
+		m.logf(`error preparing template "%s": %s`, name, err)
+		return nil, "", &errval{e: err, s: `error preparing template "` + name + `"`}
+	}
+	if t.cache == nil {
+		t.cache = make(map[string]*sql.Stmt, 1)
+	}
+	t.cache[q] = s
+	m.lock.Unlock()
+	return s, q, nil
+}
+func (m *Map) closeTemplates() error {
+	var r []error
+	for k, v := range m.templates {
+		for q, s := range v.cache {
+			if err := s.Close(); err != nil {
+				r = append(r, &errval{e: err, s: `closing template "` + k + `"`})
+				continue
+			}
+			delete(v.cache, q)
+		}
+	}
+	return errors.Join(r...)
+}
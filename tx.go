@@ -0,0 +1,314 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Tx is a struct that allows for executing the statements of a Map inside of a
+// transaction. Tx structs are created by the 'WithTx' function of a Map and are
+// only valid inside the supplied function.
+type Tx struct {
+	m  *Map
+	tx *sql.Tx
+}
+
+// Tx returns the underlying transaction.
+func (t *Tx) Tx() *sql.Tx {
+	return t.tx
+}
+
+// WithTx will start a new transaction and call the supplied function with a Tx
+// that can be used to execute the statements of the Map inside the transaction.
+//
+// If the function returns nil, the transaction will be committed. If the function
+// returns an error or panics, the transaction will be rolled back. Panics will be
+// re-raised after the rollback.
+func (m *Map) WithTx(f func(*Tx) error) error {
+	return m.WithTxContext(context.Background(), f)
+}
+
+// Exec will attempt to get the statement with the provided name and then attempt
+// to call the 'Exec' function on the statement inside the transaction.
+//
+// This provides the results of the Exec function.
+func (t *Tx) Exec(name string, args ...interface{}) (sql.Result, error) {
+	x, f := t.m.context(name)
+	r, err := t.ExecContext(x, name, args...)
+	f()
+	return r, err
+}
+
+// Query will attempt to get the statement with the provided name and then attempt
+// to call the 'Query' function on the statement inside the transaction.
+//
+// This provides the results of the Query function.
+func (t *Tx) Query(name string, args ...interface{}) (*sql.Rows, error) {
+	// The cancel function is not called here as it would close the returned
+	// Rows. The Context will be released once the Timeout expires instead.
+	x, _ := t.m.context(name)
+	return t.QueryContext(x, name, args...)
+}
+
+// QueryRow will attempt to get the statement with the provided name and then attempt
+// to call the 'QueryRow' function on the statement inside the transaction.
+//
+// This function differs from the original 'QueryRow' statement as this provides
+// a boolean to indicate if the provided named statement was found.
+//
+// If the returned boolean is True, the result is not-nil and safe to use.
+func (t *Tx) QueryRow(name string, args ...interface{}) (*sql.Row, bool) {
+	x, _ := t.m.context(name)
+	return t.QueryRowContext(x, name, args...)
+}
+
+// Savepoint will create a savepoint with the provided name inside the transaction.
+// The transaction can later be rolled back to this point using 'RollbackTo'
+// without rolling back the entire transaction.
+//
+// The name may only contain letters, digits and underscores.
+func (t *Tx) Savepoint(name string) error {
+	return t.SavepointContext(context.Background(), name)
+}
+
+// RollbackTo will roll back the transaction to the savepoint with the provided
+// name, undoing any changes made after the savepoint was created. The savepoint
+// remains valid after this call.
+//
+// The name may only contain letters, digits and underscores.
+func (t *Tx) RollbackTo(name string) error {
+	return t.RollbackToContext(context.Background(), name)
+}
+
+// Release will release (remove) the savepoint with the provided name, keeping
+// any changes made after the savepoint was created.
+//
+// The name may only contain letters, digits and underscores.
+func (t *Tx) Release(name string) error {
+	return t.ReleaseContext(context.Background(), name)
+}
+
+// WithTxContext will start a new transaction and call the supplied function with
+// a Tx that can be used to execute the statements of the Map inside the
+// transaction.
+//
+// If the function returns nil, the transaction will be committed. If the function
+// returns an error or panics, the transaction will be rolled back. Panics will be
+// re-raised after the rollback.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// transaction. If the Context is cancelled, the transaction will be rolled back.
+func (m *Map) WithTxContext(x context.Context, f func(*Tx) error) error {
+	if m == nil || m.database() == nil {
+		return ErrInvalidDB
+	}
+	v, err := m.database().BeginTx(x, nil)
+	if err != nil {
+		return &errval{e: err, s: "error starting transaction"}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			v.Rollback()
+			panic(r)
+		}
+	}()
+	if err = f(&Tx{m: m, tx: v}); err != nil {
+		v.Rollback()
+		return err
+	}
+	if err = v.Commit(); err != nil {
+		return &errval{e: err, s: "error committing transaction"}
+	}
+	return nil
+}
+
+// ExecContext will attempt to get the statement with the provided name and then
+// attempt to call the 'Exec' function on the statement inside the transaction.
+//
+// This provides the results of the Exec function.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Exec function.
+func (t *Tx) ExecContext(x context.Context, name string, args ...interface{}) (sql.Result, error) {
+	if !t.m.hooked() {
+		r, _, err := t.exec(x, name, args)
+		return r, err
+	}
+	x, f := t.m.trace(x, name, "Exec")
+	r, e, err := t.exec(x, name, args)
+	f(e, err)
+	return r, err
+}
+
+// QueryContext will attempt to get the statement with the provided name and then
+// attempt to call the 'Query' function on the statement inside the transaction.
+//
+// This provides the results of the Query function.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (t *Tx) QueryContext(x context.Context, name string, args ...interface{}) (*sql.Rows, error) {
+	if !t.m.hooked() {
+		r, _, err := t.query(x, name, args)
+		return r, err
+	}
+	x, f := t.m.trace(x, name, "Query")
+	r, e, err := t.query(x, name, args)
+	f(e, err)
+	return r, err
+}
+
+// QueryRowContext will attempt to get the statement with the provided name and
+// then attempt to call the 'QueryRow' function on the statement inside the
+// transaction.
+//
+// This function differs from the original 'QueryRow' statement as this provides
+// a boolean to indicate if the provided named statement was found.
+//
+// If the returned boolean is True, the result is not-nil and safe to use.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Query function.
+func (t *Tx) QueryRowContext(x context.Context, name string, args ...interface{}) (*sql.Row, bool) {
+	if !t.m.hooked() {
+		r, _, err := t.queryRow(x, name, args)
+		return r, err == nil
+	}
+	x, f := t.m.trace(x, name, "QueryRow")
+	r, e, err := t.queryRow(x, name, args)
+	if err == nil {
+		f(e, r.Err())
+	} else {
+		f(e, err)
+	}
+	return r, err == nil
+}
+
+// SavepointContext will create a savepoint with the provided name inside the
+// transaction. The transaction can later be rolled back to this point using
+// 'RollbackTo' without rolling back the entire transaction.
+//
+// The name may only contain letters, digits and underscores.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Exec function.
+func (t *Tx) SavepointContext(x context.Context, name string) error {
+	return t.savepoint(x, "SAVEPOINT ", name)
+}
+
+// RollbackToContext will roll back the transaction to the savepoint with the
+// provided name, undoing any changes made after the savepoint was created. The
+// savepoint remains valid after this call.
+//
+// The name may only contain letters, digits and underscores.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Exec function.
+func (t *Tx) RollbackToContext(x context.Context, name string) error {
+	return t.savepoint(x, "ROLLBACK TO SAVEPOINT ", name)
+}
+
+// ReleaseContext will release (remove) the savepoint with the provided name,
+// keeping any changes made after the savepoint was created.
+//
+// The name may only contain letters, digits and underscores.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// Exec function.
+func (t *Tx) ReleaseContext(x context.Context, name string) error {
+	return t.savepoint(x, "RELEASE SAVEPOINT ", name)
+}
+func (t *Tx) savepoint(x context.Context, q, name string) error {
+	if len(name) == 0 {
+		return &errval{s: "savepoint name cannot be empty"}
+	}
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return &errval{s: `invalid savepoint name "` + name + `"`}
+		}
+	}
+	if _, err := t.tx.ExecContext(x, q+name); err != nil {
+		return &errval{e: err, s: `error executing savepoint "` + name + `"`}
+	}
+	return nil
+}
+func (t *Tx) stmt(x context.Context, name string) (*entry, *sql.Stmt, error) {
+	e, s, err := t.m.stmt(x, name, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s == nil {
+		return e, nil, nil
+	}
+	return e, t.tx.StmtContext(x, s), nil
+}
+func (t *Tx) exec(x context.Context, name string, args []interface{}) (sql.Result, *entry, error) {
+	return intercept(t.m.middleware(), x, name, "Exec", args, t.execStmt)
+}
+func (t *Tx) execStmt(x context.Context, name string, args []interface{}) (sql.Result, *entry, error) {
+	e, s, err := t.stmt(x, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = t.m.validate(e, name, false, args); err != nil {
+		return nil, e, err
+	}
+	if s == nil {
+		r, err := t.tx.ExecContext(x, e.text, args...)
+		return r, e, err
+	}
+	r, err := s.ExecContext(x, args...)
+	return r, e, err
+}
+func (t *Tx) query(x context.Context, name string, args []interface{}) (*sql.Rows, *entry, error) {
+	return intercept(t.m.middleware(), x, name, "Query", args, t.queryStmt)
+}
+func (t *Tx) queryStmt(x context.Context, name string, args []interface{}) (*sql.Rows, *entry, error) {
+	e, s, err := t.stmt(x, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = t.m.validate(e, name, true, args); err != nil {
+		return nil, e, err
+	}
+	if s == nil {
+		r, err := t.tx.QueryContext(x, e.text, args...)
+		return r, e, err
+	}
+	r, err := s.QueryContext(x, args...)
+	return r, e, err
+}
+func (t *Tx) queryRow(x context.Context, name string, args []interface{}) (*sql.Row, *entry, error) {
+	return intercept(t.m.middleware(), x, name, "QueryRow", args, t.queryRowStmt)
+}
+func (t *Tx) queryRowStmt(x context.Context, name string, args []interface{}) (*sql.Row, *entry, error) {
+	e, s, err := t.stmt(x, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = t.m.validate(e, name, true, args); err != nil {
+		return nil, e, err
+	}
+	if s == nil {
+		return t.tx.QueryRowContext(x, e.text, args...), e, nil
+	}
+	return s.QueryRowContext(x, args...), e, nil
+}
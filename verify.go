@@ -0,0 +1,192 @@
+// Copyright 2021 - 2023 PurpleSec Team
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mapper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// Verify will check that each of the prepared statements in the Map is still
+// usable, without executing any of them.
+//
+// Each statement is checked to make sure that it has not been closed and that it
+// can be prepared on a pooled connection. A list of errors, one for each broken
+// statement and containing the statement name, will be returned. If all the
+// statements are usable, this function returns nil.
+//
+// This is best-effort, as some drivers will not report errors until a statement
+// is executed. Broken statements can be fixed using 'Reprepare'.
+//
+// Statements added when the 'Passthrough' property is True are not checked.
+func (m *Map) Verify() []error {
+	return m.VerifyContext(context.Background())
+}
+
+// VerifyContext will check that each of the prepared statements in the Map is
+// still usable, without executing any of them.
+//
+// Each statement is checked to make sure that it has not been closed and that it
+// can be prepared on a pooled connection. A list of errors, one for each broken
+// statement and containing the statement name, will be returned. If all the
+// statements are usable, this function returns nil.
+//
+// This is best-effort, as some drivers will not report errors until a statement
+// is executed. Broken statements can be fixed using 'Reprepare'.
+//
+// Statements added when the 'Passthrough' property is True are not checked.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) VerifyContext(x context.Context) []error {
+	if m == nil || m.database() == nil {
+		return []error{ErrInvalidDB}
+	}
+	m.lock.RLock()
+	var (
+		n = make([]string, 0, len(m.entries))
+		l = make([]*sql.Stmt, 0, len(m.entries))
+	)
+	for k, v := range m.entries {
+		if v == nil || v.conn != nil || v.stmt == nil {
+			continue
+		}
+		n, l = append(n, k), append(l, v.stmt)
+	}
+	m.lock.RUnlock()
+	if len(l) == 0 {
+		return nil
+	}
+	t, err := m.database().BeginTx(x, nil)
+	if err != nil {
+		return []error{&errval{e: err, s: "error starting transaction"}}
+	}
+	// Statements given a cancelled Context will report any closed or prepare
+	// errors before they attempt to use a connection, so nothing is executed.
+	c, f := context.WithCancel(x)
+	f()
+	var r []error
+	for i := range l {
+		if err = check(c, l[i]); err == nil {
+			err = check(c, t.StmtContext(x, l[i]))
+		}
+		if err != nil {
+			r = append(r, &errval{e: err, s: `mapping "` + n[i] + `"`})
+		}
+	}
+	t.Rollback()
+	return r
+}
+func check(x context.Context, s *sql.Stmt) error {
+	r, err := s.QueryContext(x)
+	if err == nil {
+		r.Close()
+		return nil
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// VerifyAll will re-prepare the query of each statement in the Map against the
+// current database, closing each test statement once prepared. A map of
+// statement names to the error returned when preparing them will be returned.
+// If all the queries can be prepared, the returned map is nil.
+//
+// The returned error is only set if the Map or the Database is nil, in which
+// case 'ErrInvalidDB' is returned.
+//
+// Unlike 'Verify', which checks the existing prepared statements, this will catch
+// queries that were valid when added but are no longer valid, such as after a
+// schema change. The existing statements are not modified, so any broken
+// statements can be replaced using 'Reprepare' or 'Add'.
+//
+// Statements added when the 'Passthrough' property is True and Lazy statements
+// that have not been used yet are also checked.
+func (m *Map) VerifyAll() (map[string]error, error) {
+	return m.VerifyAllContext(context.Background())
+}
+
+// VerifyAllContext will re-prepare the query of each statement in the Map
+// against the current database, closing each test statement once prepared. A
+// map of statement names to the error returned when preparing them will be
+// returned. If all the queries can be prepared, the returned map is nil.
+//
+// The returned error is only set if the Map or the Database is nil, in which
+// case 'ErrInvalidDB' is returned.
+//
+// Unlike 'Verify', which checks the existing prepared statements, this will catch
+// queries that were valid when added but are no longer valid, such as after a
+// schema change. The existing statements are not modified, so any broken
+// statements can be replaced using 'Reprepare' or 'Add'.
+//
+// Statements added when the 'Passthrough' property is True and Lazy statements
+// that have not been used yet are also checked.
+//
+// This function specifies a Context that can be used to interrupt and cancel the
+// prepare calls.
+func (m *Map) VerifyAllContext(x context.Context) (map[string]error, error) {
+	if m == nil || m.database() == nil {
+		return nil, ErrInvalidDB
+	}
+	m.lock.RLock()
+	var (
+		n = make([]string, 0, len(m.entries))
+		l = make([]*entry, 0, len(m.entries))
+	)
+	for k, v := range m.entries {
+		if v == nil || len(v.query) == 0 {
+			continue
+		}
+		n, l = append(n, k), append(l, v)
+	}
+	m.lock.RUnlock()
+	var r map[string]error
+	for i := range l {
+		if err := m.reverify(x, l[i]); err != nil {
+			if r == nil {
+				r = make(map[string]error)
+			}
+			r[n[i]] = &errval{e: err, s: `error preparing mapping "` + n[i] + `"`}
+		}
+	}
+	return r, nil
+}
+func (m *Map) reverify(x context.Context, e *entry) error {
+	var (
+		s   *sql.Stmt
+		q   = m.Dialect.rewrite(e.query)
+		err error
+	)
+	if e.conn != nil {
+		s, err = e.conn.PrepareContext(x, q)
+	} else {
+		s, err = m.database().PrepareContext(x, q)
+	}
+	if err != nil {
+		return err
+	}
+	if s.Close(); e.conn != nil || m.ReadDatabase == nil {
+		return nil
+	}
+	if s, err = m.ReadDatabase.PrepareContext(x, q); err != nil {
+		return err
+	}
+	s.Close()
+	return nil
+}